@@ -0,0 +1,212 @@
+package archer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// assertion checks the content of a response, it returns error
+// describing the mismatch if response is not expected.
+type assertion func(res *fasthttp.Response) error
+
+// parseAssertion parses assertion string, supported formats are:
+//
+//	contains:TEXT      body contains TEXT
+//	regex:REGEXP       body matches REGEXP
+//	json:PATH=VALUE    JSON field at dot separated PATH equals VALUE,
+//	                   e.g. json:data.items.0.id=1
+//	header:NAME        response has header NAME
+//	size:MIN-MAX       body size is in [MIN, MAX], empty MIN or MAX
+//	                   means no limit, e.g. size:-1024
+func parseAssertion(raw string) (assertion, error) {
+	i := strings.Index(raw, ":")
+	if i < 0 {
+		return nil, errors.New("invalid assertion: " + raw)
+	}
+	kind, arg := raw[:i], raw[i+1:]
+	switch kind {
+	case "contains":
+		text := []byte(arg)
+		return func(res *fasthttp.Response) error {
+			if !bytes.Contains(res.Body(), text) {
+				return errors.New("body does not contain " + strconv.Quote(arg))
+			}
+			return nil
+		}, nil
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(res *fasthttp.Response) error {
+			if !re.Match(res.Body()) {
+				return errors.New("body does not match " + strconv.Quote(arg))
+			}
+			return nil
+		}, nil
+	case "json":
+		j := strings.Index(arg, "=")
+		if j <= 0 {
+			return nil, errors.New("invalid assertion: " + raw)
+		}
+		path := strings.Split(arg[:j], ".")
+		var expect interface{}
+		// value which is not valid JSON is compared as string
+		if err := json.Unmarshal([]byte(arg[j+1:]), &expect); err != nil {
+			expect = arg[j+1:]
+		}
+		return func(res *fasthttp.Response) error {
+			var body interface{}
+			if err := json.Unmarshal(res.Body(), &body); err != nil {
+				return errors.New("body is not JSON: " + err.Error())
+			}
+			v, ok := lookupJSON(body, path)
+			if !ok {
+				return errors.New("JSON field " + arg[:j] + " not found")
+			}
+			if !reflect.DeepEqual(v, expect) {
+				return fmt.Errorf("JSON field %s is %v, expecting %v", arg[:j], v, expect)
+			}
+			return nil
+		}, nil
+	case "header":
+		if len(arg) == 0 {
+			return nil, errors.New("invalid assertion: " + raw)
+		}
+		return func(res *fasthttp.Response) error {
+			if len(res.Header.Peek(arg)) == 0 {
+				return errors.New("header " + arg + " not found")
+			}
+			return nil
+		}, nil
+	case "size":
+		j := strings.Index(arg, "-")
+		if j < 0 {
+			return nil, errors.New("invalid assertion: " + raw)
+		}
+		min, max := 0, -1
+		var err error
+		if len(arg[:j]) > 0 {
+			if min, err = strconv.Atoi(arg[:j]); err != nil {
+				return nil, err
+			}
+		}
+		if len(arg[j+1:]) > 0 {
+			if max, err = strconv.Atoi(arg[j+1:]); err != nil {
+				return nil, err
+			}
+		}
+		return func(res *fasthttp.Response) error {
+			size := len(res.Body())
+			if size < min || (max >= 0 && size > max) {
+				return fmt.Errorf("body size %d not in %s", size, arg)
+			}
+			return nil
+		}, nil
+	}
+	return nil, errors.New("invalid assertion: " + raw)
+}
+
+// lookupJSON returns the value at path of decoded JSON v
+func lookupJSON(v interface{}, path []string) (interface{}, bool) {
+	for _, p := range path {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = c[p]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// DefaultAssertSamples is the default number of assertion samples kept
+const DefaultAssertSamples = 10
+
+// maxSampleBody limits the body size saved in assertion samples
+const maxSampleBody = 4096
+
+// assertSample is a response failed assertion
+type assertSample struct {
+	Request string `json:"request"`
+	Error   string `json:"error"`
+	Status  int    `json:"status"`
+	Header  string `json:"header"`
+	Body    string `json:"body"`
+}
+
+// assertSamples keeps the first max responses failed assertions
+type assertSamples struct {
+	sync.Mutex
+	max uint64
+	// responses failed assertions, 64 bits never wrap in practice
+	count   uint64
+	samples []assertSample
+}
+
+// Add saves a sample of res if there are less than max samples
+func (s *assertSamples) Add(req *fasthttp.Request, res *fasthttp.Response, err error) {
+	if atomic.AddUint64(&s.count, 1) > s.max {
+		return
+	}
+	body := res.Body()
+	if len(body) > maxSampleBody {
+		body = body[:maxSampleBody]
+	}
+	sample := assertSample{
+		Request: string(req.Header.Method()) + " " + string(req.URI().FullURI()),
+		Error:   err.Error(),
+		Status:  res.StatusCode(),
+		Header:  res.Header.String(),
+		Body:    string(body),
+	}
+	s.Lock()
+	s.samples = append(s.samples, sample)
+	s.Unlock()
+}
+
+// Save writes samples to path as JSONL, or prints them if path is empty
+func (s *assertSamples) Save(path string) error {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.samples) == 0 {
+		return nil
+	}
+	if len(path) == 0 {
+		for i, sample := range s.samples {
+			log.Printf("Assertion Sample #%d %s: %s, status: %d, body: %q",
+				i+1, sample.Request, sample.Error, sample.Status, sample.Body)
+		}
+		return nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, sample := range s.samples {
+		if err := enc.Encode(sample); err != nil {
+			return err
+		}
+	}
+	log.Printf("Assertion samples saved to %s", path)
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
@@ -0,0 +1,103 @@
+package archer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestAssertion(t *testing.T) {
+	var tests = []struct {
+		s      string
+		header string
+		body   string
+		pass   bool
+		err    bool
+	}{
+		{"contains:ok", "", `{"status": "ok"}`, true, false},
+		{"contains:ok", "", `{"status": "error"}`, false, false},
+		{"regex:^\\{.*\\}$", "", `{"status": "ok"}`, true, false},
+		{"regex:^\\[", "", `{"status": "ok"}`, false, false},
+		{"regex:(", "", "", false, true},
+		{"json:status=ok", "", `{"status": "ok"}`, true, false},
+		{`json:status="ok"`, "", `{"status": "ok"}`, true, false},
+		{"json:data.items.1.id=2", "", `{"data": {"items": [{"id": 1}, {"id": 2}]}}`, true, false},
+		{"json:data.items.2.id=2", "", `{"data": {"items": [{"id": 1}, {"id": 2}]}}`, false, false},
+		{"json:code=0", "", `{"code": 1}`, false, false},
+		{"json:code=0", "", `not json`, false, false},
+		{"json:=0", "", "", false, true},
+		{"header:X-Request-Id", "X-Request-Id", "", true, false},
+		{"header:X-Request-Id", "X-Trace-Id", "", false, false},
+		{"size:2-4", "", "abc", true, false},
+		{"size:-2", "", "abc", false, false},
+		{"size:4-", "", "abc", false, false},
+		{"size:a-4", "", "", false, true},
+		{"unknown:abc", "", "", false, true},
+		{"abc", "", "", false, true},
+	}
+
+	for caseid, c := range tests {
+		a, err := parseAssertion(c.s)
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+			continue
+		}
+		res := &fasthttp.Response{}
+		if len(c.header) > 0 {
+			res.Header.Set(c.header, "1")
+		}
+		res.SetBodyString(c.body)
+		if err := a(res); (err == nil) != c.pass {
+			t.Errorf("case #%d, result incorrect: %v", caseid+1, err)
+		}
+	}
+}
+
+func TestAssertSamples(t *testing.T) {
+	s := assertSamples{max: 2}
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://127.0.0.1/items")
+	res := &fasthttp.Response{}
+	res.SetBody(bytes.Repeat([]byte("a"), maxSampleBody+1))
+	for i := 0; i < 5; i++ {
+		s.Add(req, res, os.ErrInvalid)
+	}
+	if len(s.samples) != 2 {
+		t.Errorf("sample number incorrect: %d", len(s.samples))
+	}
+	if len(s.samples[0].Body) != maxSampleBody {
+		t.Errorf("sample body not truncated: %d", len(s.samples[0].Body))
+	}
+	none := assertSamples{}
+	none.Add(req, res, os.ErrInvalid)
+	if len(none.samples) != 0 {
+		t.Errorf("samples kept while disabled: %d", len(none.samples))
+	}
+
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "samples.jsonl")
+	if err := s.Save(path); err != nil {
+		t.Fatalf("%s", err)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if bytes.Count(raw, []byte("\n")) != 2 || !bytes.Contains(raw, []byte(`"request":"GET http://127.0.0.1/items"`)) {
+		t.Errorf("samples file incorrect: %s", raw[:100])
+	}
+}
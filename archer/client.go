@@ -0,0 +1,202 @@
+package archer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	strHTTP  = []byte("http")
+	strHTTPS = []byte("https")
+)
+
+// doer sends requests of workers, timeout 0 means no timeout
+type doer interface {
+	Do(worker int, req *fasthttp.Request, res *fasthttp.Response, timeout time.Duration) error
+}
+
+// targetHost returns host of req and if it is an https target
+func targetHost(req *fasthttp.Request) ([]byte, bool, error) {
+	uri := req.URI()
+	isTLS := bytes.Equal(uri.Scheme(), strHTTPS)
+	if !isTLS && !bytes.Equal(uri.Scheme(), strHTTP) {
+		return nil, false, fmt.Errorf("unsupported protocol %q. http and https are supported", uri.Scheme())
+	}
+	return uri.Host(), isTLS, nil
+}
+
+// hostAddr returns host with default port of the scheme added if missing
+func hostAddr(host string, isTLS bool) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if isTLS {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// serverTLSConfig returns a copy of cfg for connecting to addr
+func serverTLSConfig(cfg *tls.Config, addr string) *tls.Config {
+	ret := cfg.Clone()
+	if len(ret.ServerName) == 0 {
+		ret.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return ret
+}
+
+// hostDoer is a fasthttp client of a single host
+type hostDoer interface {
+	Do(req *fasthttp.Request, res *fasthttp.Response) error
+	DoTimeout(req *fasthttp.Request, res *fasthttp.Response, timeout time.Duration) error
+}
+
+// client sends requests of all workers, connections to each host are
+// pooled by a fasthttp.HostClient, or a fasthttp.PipelineClient in
+// pipeline mode, dialing with the archer dialer, which also performs
+// TLS handshakes for https hosts.
+type client struct {
+	sync.RWMutex
+	dialer    *dialer
+	tlsConfig *tls.Config
+	maxConns  int
+	// pipelined requests per connection, 0 means no pipelining
+	pipeline     int
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// max connection lifetime, 0 means no limit
+	lifetime time.Duration
+	hosts    map[string]hostDoer
+	// hosts of https targets
+	tlsHosts map[string]hostDoer
+}
+
+func newClient(d *dialer, tlsConfig *tls.Config, maxConns, pipeline int, readTimeout, writeTimeout, lifetime time.Duration) *client {
+	return &client{
+		dialer:       d,
+		tlsConfig:    tlsConfig,
+		maxConns:     maxConns,
+		pipeline:     pipeline,
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		lifetime:     lifetime,
+		hosts:        make(map[string]hostDoer),
+		tlsHosts:     make(map[string]hostDoer),
+	}
+}
+
+// hostClient returns the host client of req target
+func (c *client) hostClient(req *fasthttp.Request) (hostDoer, error) {
+	host, isTLS, err := targetHost(req)
+	if err != nil {
+		return nil, err
+	}
+	hosts := c.hosts
+	if isTLS {
+		hosts = c.tlsHosts
+	}
+	c.RLock()
+	hc := hosts[string(host)]
+	c.RUnlock()
+	if hc != nil {
+		return hc, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if hc = hosts[string(host)]; hc != nil {
+		return hc, nil
+	}
+	hc = c.newHostClient(string(host), isTLS)
+	hosts[string(host)] = hc
+	return hc, nil
+}
+
+func (c *client) newHostClient(host string, isTLS bool) hostDoer {
+	addr := hostAddr(host, isTLS)
+	dial := c.dialer.Dial
+	if isTLS {
+		cfg := serverTLSConfig(c.tlsConfig, addr)
+		dial = func(addr string) (net.Conn, error) {
+			return c.dialer.DialTLS(addr, cfg)
+		}
+	}
+	if c.pipeline > 0 {
+		return &fasthttp.PipelineClient{
+			Addr:               addr,
+			Dial:               dial,
+			MaxConns:           c.maxConns,
+			MaxPendingRequests: c.pipeline,
+			ReadTimeout:        c.readTimeout,
+			WriteTimeout:       c.writeTimeout,
+		}
+	}
+	return &fasthttp.HostClient{
+		Addr:                          addr,
+		Dial:                          dial,
+		MaxConns:                      c.maxConns,
+		ReadTimeout:                   c.readTimeout,
+		WriteTimeout:                  c.writeTimeout,
+		MaxConnDuration:               c.lifetime,
+		DisableHeaderNamesNormalizing: true,
+	}
+}
+
+// maxConnWait is the longest pause before retrying a request which found
+// all connections to its host busy
+const maxConnWait = 10 * time.Millisecond
+
+// Do sends req and waits for res, connections are shared by all workers.
+// Connections may be held by timed out requests still in flight, so a
+// request finding no free connection waits for one until its timeout.
+func (c *client) Do(_ int, req *fasthttp.Request, res *fasthttp.Response, timeout time.Duration) error {
+	hc, err := c.hostClient(req)
+	if err != nil {
+		return err
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	wait := maxConnWait / 64
+	for {
+		err := c.do(hc, req, res, deadline)
+		if err != fasthttp.ErrNoFreeConns {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			return fasthttp.ErrTimeout
+		}
+		time.Sleep(wait)
+		if wait < maxConnWait {
+			wait *= 2
+		}
+	}
+}
+
+// do sends req once, zero deadline means no timeout
+func (c *client) do(hc hostDoer, req *fasthttp.Request, res *fasthttp.Response, deadline time.Time) error {
+	if deadline.IsZero() {
+		return hc.Do(req, res)
+	}
+	timeout := deadline.Sub(time.Now())
+	if timeout <= 0 {
+		return fasthttp.ErrTimeout
+	}
+	// DoTimeout moves the body of the request it is given into an internal
+	// copy, which is not moved back on timeout or by PipelineClient at all,
+	// so a copy is sent to keep the body of req for later requests
+	cp := fasthttp.AcquireRequest()
+	req.CopyTo(cp)
+	err := hc.DoTimeout(cp, res, timeout)
+	fasthttp.ReleaseRequest(cp)
+	return err
+}
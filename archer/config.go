@@ -1,15 +1,96 @@
 package archer
 
-import "os"
+import (
+	"net/url"
+	"os"
+)
+
+// Header is a http header added to archer requests
+type Header struct {
+	Key   string
+	Value string
+}
 
 // Config is the config settings for stress archer
 type Config struct {
 	// target url
 	Target string
+	// weighted target list, Target, Method and Data are ignored if set
+	Endpoints []Endpoint
+	// captured requests to replay, Endpoints and Target are ignored if set,
+	// Headers replace captured headers with the same names
+	Replay []Record
+	// replay speed relative to captured timing, e.g. 2 replays twice as fast,
+	// 0 means as fast as possible
+	ReplaySpeed float64
+	// http request method, default is PUT
+	Method string
+	// extra http request headers
+	Headers []Header
+	// extra query parameters added to target url
+	Query url.Values
+	// comma separated status codes counted as success, e.g. 200,201-204,3xx,
+	// default is DefaultSuccessStatus
+	SuccessStatus string
+	// response assertions, e.g. contains:ok, regex:^\{, json:code=0,
+	// header:X-Request-Id or size:10-1024
+	Assertions []string
+	// number of responses failed assertions kept as samples, 0 means
+	// DefaultAssertSamples and negative means no samples are kept
+	AssertSamples int
+	// file samples are written to as JSONL, empty means printing them
+	AssertSampleFile string
 	// interval duration
 	Interval string
+	// requests per second on a global clock, 0 means each connection
+	// sends request after Interval once previous one is done
+	Rate uint64
+	// load profile, e.g. ramp:100-1000:30s, steps:100,200,400:10s,
+	// spike:100-2000:30s:5s or stages:0-500:10s,500:1m
+	Profile string
+	// unit of profile load levels, ProfileUnitRate (default) or
+	// ProfileUnitConn, which replaces ConnNum by the highest level
+	ProfileUnit string
+	// timeout of a whole request, empty means no timeout
+	RequestTimeout string
+	// connect timeout, default is 3s
+	ConnectTimeout string
+	// timeout of each read and write on connections, empty means no timeout
+	ReadTimeout  string
+	WriteTimeout string
+	// TLS settings of https targets
+	TLS TLSConfig
 	// connection number
 	ConnNum int
+	// send requests over HTTP/2, h2 for https targets and h2c (prior
+	// knowledge) for http targets
+	HTTP2 bool
+	// concurrent HTTP/2 streams per connection, default is 1
+	Streams int
+	// pipelined HTTP/1.1 requests per connection, 0 means no pipelining
+	Pipeline int
+	// requests sent on a connection before it is closed, 1 means a new
+	// connection per request, 0 means connections are kept alive
+	ConnRequests uint64
+	// max lifetime of a connection, empty means no limit
+	ConnLifetime string
+	// idle keep-alive connections to open and hold instead of sending
+	// requests, 0 disables hold mode
+	Hold int
+	// connections opened per second in hold mode, 0 means as fast as
+	// ConnNum concurrent dialers can
+	HoldRate uint64
+	// interval of keep-alive requests on held connections, empty means
+	// connections are kept idle
+	PingInterval string
+	// local IP addresses connections are bound to in turn, empty means
+	// chosen by system
+	Sources []string
+	// DNS overrides in curl style HOST:PORT:IP[,IP...]
+	Resolve []string
+	// spread connections across all addresses of target hosts, otherwise
+	// the first reachable one is used
+	SpreadDNS bool
 	// data
 	Data []byte
 	// if print log periodically
@@ -18,6 +99,8 @@ type Config struct {
 	PrintError bool
 	// total number, 0 means non-stop
 	Num uint64
+	// run duration, empty means non-stop
+	Duration string
 	// signal channel for SIGHUP
 	Sighup chan os.Signal
 }
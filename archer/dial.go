@@ -0,0 +1,311 @@
+package archer
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// dnsCacheDuration is how long resolved addresses of a host are reused
+const dnsCacheDuration = time.Minute
+
+// dialer opens connections for archer workers
+type dialer struct {
+	// connect timeout, it limits DNS lookup and TLS handshake as well
+	timeout time.Duration
+	// TCP connect durations, its count is the number of connections opened
+	connect *histogram
+	// TLS handshake durations
+	handshake *histogram
+	// DNS lookup durations, cached and overridden hosts are not counted
+	dns *histogram
+	// measure time to first byte and transfer time of responses, only
+	// for connections sending one request at a time
+	phases   bool
+	ttfb     *histogram
+	transfer *histogram
+	// bytes written to and read from connections, including TLS records
+	sent     uint64
+	received uint64
+	// local addresses connections are bound to in turn, nil means
+	// chosen by system
+	sources []*net.TCPAddr
+	next    uint32
+	// addresses of host:port used instead of DNS lookup
+	resolve map[string][]net.IP
+	// spread connections across all addresses of a host, otherwise
+	// the first reachable one is used
+	spread bool
+	// DNS lookup, it is net.LookupIP except in tests
+	lookupIP func(host string) ([]net.IP, error)
+	mu       sync.Mutex
+	hosts    map[string]*dnsEntry
+	// open connections, they are closed by CloseAll
+	connMu sync.Mutex
+	conns  map[*wireConn]struct{}
+	closed bool
+}
+
+// errDialerClosed is returned by dialing after CloseAll
+var errDialerClosed = errors.New("dialer closed")
+
+// dnsEntry is the resolved addresses of a host, ips, err and resolved are
+// set before done is closed
+type dnsEntry struct {
+	done     chan struct{}
+	ips      []net.IP
+	err      error
+	resolved time.Time
+	// index of next address connected in spread mode
+	next uint32
+}
+
+// expired returns true if e is resolved and needs to be looked up again,
+// it is never true for overridden addresses
+func (e *dnsEntry) expired() bool {
+	select {
+	case <-e.done:
+	default:
+		return false
+	}
+	return e.err != nil || (!e.resolved.IsZero() && time.Since(e.resolved) >= dnsCacheDuration)
+}
+
+func newDialer(timeout time.Duration, sources []*net.TCPAddr, resolve map[string][]net.IP, spread bool) *dialer {
+	if timeout <= 0 {
+		timeout = fasthttp.DefaultDialTimeout
+	}
+	return &dialer{
+		timeout:   timeout,
+		connect:   newHistogram(),
+		handshake: newHistogram(),
+		dns:       newHistogram(),
+		ttfb:      newHistogram(),
+		transfer:  newHistogram(),
+		sources:   sources,
+		resolve:   resolve,
+		spread:    spread,
+		lookupIP:  net.LookupIP,
+		hosts:     make(map[string]*dnsEntry),
+		conns:     make(map[*wireConn]struct{}),
+	}
+}
+
+// parseSources parses local IP addresses connections are bound to
+func parseSources(ips []string) ([]*net.TCPAddr, error) {
+	var ret []*net.TCPAddr
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("invalid source address: " + s)
+		}
+		ret = append(ret, &net.TCPAddr{IP: ip})
+	}
+	return ret, nil
+}
+
+// parseResolve parses DNS overrides in curl style HOST:PORT:IP[,IP...]
+// into addresses of each HOST:PORT
+func parseResolve(rules []string) (map[string][]net.IP, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string][]net.IP)
+	for _, r := range rules {
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, errors.New("invalid resolve: " + r)
+		}
+		key := net.JoinHostPort(parts[0], parts[1])
+		for _, s := range strings.Split(parts[2], ",") {
+			ip := net.ParseIP(strings.Trim(s, "[]"))
+			if ip == nil {
+				return nil, errors.New("invalid resolve address: " + s)
+			}
+			ret[key] = append(ret[key], ip)
+		}
+	}
+	return ret, nil
+}
+
+// lookup returns the addresses of host, from overrides of addr, the
+// cache, or a DNS lookup. Only one lookup of a host runs at a time, other
+// callers wait for its result without blocking lookups of other hosts.
+func (d *dialer) lookup(addr, host string) (*dnsEntry, error) {
+	d.mu.Lock()
+	e := d.hosts[addr]
+	if e != nil && !e.expired() {
+		d.mu.Unlock()
+		<-e.done
+		if e.err != nil {
+			return nil, e.err
+		}
+		return e, nil
+	}
+	e = &dnsEntry{done: make(chan struct{})}
+	d.hosts[addr] = e
+	d.mu.Unlock()
+
+	defer close(e.done)
+	if ips, ok := d.resolve[addr]; ok {
+		// overrides never expire
+		e.ips = ips
+	} else if ip := net.ParseIP(host); ip != nil {
+		e.ips = []net.IP{ip}
+	} else {
+		start := time.Now()
+		e.ips, e.err = d.lookupHost(host)
+		if e.err != nil {
+			return nil, e.err
+		}
+		d.dns.Record(time.Since(start))
+		e.resolved = time.Now()
+	}
+	return e, nil
+}
+
+// lookupHost looks up addresses of host, it gives up after the connect
+// timeout and leaves the lookup running in background.
+func (d *dialer) lookupHost(host string) ([]net.IP, error) {
+	type result struct {
+		ips []net.IP
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		ips, err := d.lookupIP(host)
+		ch <- result{ips, err}
+	}()
+	t := time.NewTimer(d.timeout)
+	defer t.Stop()
+	select {
+	case r := <-ch:
+		return r.ips, r.err
+	case <-t.C:
+		return nil, &net.DNSError{Err: "lookup timed out", Name: host, IsTimeout: true}
+	}
+}
+
+// Dial connects to addr, it is used as fasthttp.DialFunc
+func (d *dialer) Dial(addr string) (net.Conn, error) {
+	conn, err := d.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return d.wrap(conn), nil
+}
+
+// wrap returns conn measuring response phases if it is enabled
+func (d *dialer) wrap(conn net.Conn) net.Conn {
+	if !d.phases {
+		return conn
+	}
+	return &phaseConn{Conn: conn, d: d}
+}
+
+// dial connects to addr from the next source address. Addresses of the
+// host are tried in order until one is connected, starting from the next
+// one in spread mode.
+func (d *dialer) dial(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	e, err := d.lookup(addr, host)
+	if err != nil {
+		return nil, err
+	}
+	nd := net.Dialer{Timeout: d.timeout}
+	if len(d.sources) > 0 {
+		i := atomic.AddUint32(&d.next, 1)
+		nd.LocalAddr = d.sources[int(i%uint32(len(d.sources)))]
+	}
+	first := 0
+	if d.spread {
+		first = int((atomic.AddUint32(&e.next, 1) - 1) % uint32(len(e.ips)))
+	}
+	for i := range e.ips {
+		ip := e.ips[(first+i)%len(e.ips)]
+		start := time.Now()
+		var conn net.Conn
+		if conn, err = nd.Dial("tcp", net.JoinHostPort(ip.String(), port)); err == nil {
+			d.connect.Record(time.Since(start))
+			return d.track(conn)
+		}
+	}
+	return nil, err
+}
+
+// track returns conn counting bytes and closed by CloseAll
+func (d *dialer) track(conn net.Conn) (net.Conn, error) {
+	wc := &wireConn{Conn: conn, d: d}
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+	if d.closed {
+		conn.Close()
+		return nil, errDialerClosed
+	}
+	d.conns[wc] = struct{}{}
+	return wc, nil
+}
+
+// CloseAll closes all open connections and fails dialing afterwards,
+// pending reads and writes of the connections return errors.
+func (d *dialer) CloseAll() {
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+	d.closed = true
+	for c := range d.conns {
+		c.Conn.Close()
+	}
+	d.conns = nil
+}
+
+// wireConn counts bytes written to and read from the network
+type wireConn struct {
+	net.Conn
+	d *dialer
+}
+
+func (c *wireConn) Close() error {
+	c.d.connMu.Lock()
+	delete(c.d.conns, c)
+	c.d.connMu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *wireConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.d.sent, uint64(n))
+	return n, err
+}
+
+func (c *wireConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.d.received, uint64(n))
+	return n, err
+}
+
+// DialTLS connects to addr and completes TLS handshake with cfg
+func (d *dialer) DialTLS(addr string, cfg *tls.Config) (net.Conn, error) {
+	conn, err := d.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	tc := tls.Client(conn, cfg)
+	tc.SetDeadline(start.Add(d.timeout))
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, &handshakeError{err}
+	}
+	d.handshake.Record(time.Since(start))
+	tc.SetDeadline(time.Time{})
+	return d.wrap(tc), nil
+}
@@ -0,0 +1,164 @@
+package archer
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseResolve(t *testing.T) {
+	var tests = []struct {
+		rules   []string
+		resolve map[string][]net.IP
+		err     bool
+	}{
+		{
+			nil,
+			nil,
+			false,
+		},
+		{
+			[]string{"example.com:443:10.0.0.1,10.0.0.2", "example.com:80:[::1]"},
+			map[string][]net.IP{
+				"example.com:443": {net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+				"example.com:80":  {net.ParseIP("::1")},
+			},
+			false,
+		},
+		{
+			[]string{"example.com:10.0.0.1"},
+			nil,
+			true,
+		},
+		{
+			[]string{"example.com:80:abc"},
+			nil,
+			true,
+		},
+	}
+	for i, tt := range tests {
+		resolve, err := parseResolve(tt.rules)
+		if (err != nil) != tt.err {
+			t.Errorf("case #%d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(resolve, tt.resolve) {
+			t.Errorf("case #%d: resolve incorrect: %v, expecting %v", i+1, resolve, tt.resolve)
+		}
+	}
+}
+
+func TestDialerLookup(t *testing.T) {
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	var tests = []struct {
+		spread bool
+		// addresses connected in order
+		addrs []string
+	}{
+		{
+			false,
+			[]string{"127.0.0.1", "127.0.0.1", "127.0.0.1"},
+		},
+		{
+			true,
+			[]string{"127.0.0.1", "127.0.0.2", "127.0.0.1"},
+		},
+	}
+	for i, tt := range tests {
+		resolve, err := parseResolve([]string{"stress.test:" + port + ":127.0.0.1,127.0.0.2"})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		d := newDialer(0, nil, resolve, tt.spread)
+		for j, addr := range tt.addrs {
+			conn, err := d.Dial(net.JoinHostPort("stress.test", port))
+			if err != nil {
+				t.Fatalf("case #%d: %s", i+1, err)
+			}
+			if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != addr {
+				t.Errorf("case #%d: connection #%d to %s, expecting %s", i+1, j+1, host, addr)
+			}
+			conn.Close()
+		}
+		if d.dns.Count() != 0 {
+			t.Errorf("case #%d: overridden host is looked up", i+1)
+		}
+	}
+
+	d := newDialer(0, nil, nil, false)
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(net.JoinHostPort("localhost", port))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		conn.Close()
+	}
+	if d.dns.Count() != 1 {
+		t.Errorf("DNS lookup count incorrect: %d", d.dns.Count())
+	}
+	if _, err := d.Dial("stress.invalid:80"); classifyError(err) != errDNS {
+		t.Errorf("lookup error incorrect: %v", err)
+	}
+}
+
+func TestDialerLookupConcurrent(t *testing.T) {
+	var (
+		slow    int32
+		release = make(chan struct{})
+	)
+	d := newDialer(200*time.Millisecond, nil, nil, false)
+	d.lookupIP = func(host string) ([]net.IP, error) {
+		if host == "slow.test" {
+			atomic.AddInt32(&slow, 1)
+			<-release
+		}
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}
+	defer close(release)
+	if _, err := d.lookup("fast.test:80", "fast.test"); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = d.lookup("slow.test:80", "slow.test")
+		}(i)
+	}
+	// cached host is not blocked by the pending lookup
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := d.lookup("fast.test:80", "fast.test"); err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("cached lookup blocked: %v %v", err, time.Since(start))
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if classifyError(err) != errDNS {
+			t.Errorf("lookup #%d error incorrect: %v", i+1, err)
+		}
+	}
+	if n := atomic.LoadInt32(&slow); n != 1 {
+		t.Errorf("host looked up %d times concurrently", n)
+	}
+}
@@ -0,0 +1,151 @@
+package archer
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Endpoint is a request target of archer, when multiple endpoints are
+// configured, requests are sent to them in proportion to Weight.
+type Endpoint struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	Body   string `json:"body"`
+	// relative weight, 0 means 1
+	Weight uint `json:"weight"`
+}
+
+// LoadEndpoints reads endpoint list from a YAML or JSON file, e.g.
+//
+//   - url: http://127.0.0.1:8080/items
+//     method: GET
+//     weight: 9
+//   - url: http://127.0.0.1:8080/items
+//     method: POST
+//     body: '{"name": "stress"}'
+//     weight: 1
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Endpoint
+	if err := yaml.Unmarshal(raw, &ret); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no endpoint found in " + path)
+	}
+	return ret, nil
+}
+
+// endpoint is an Endpoint prepared for sending with its own stats
+type endpoint struct {
+	target string
+	host   string
+	method string
+	data   []byte
+	weight uint
+	// url and body templates, nil if they have no variables
+	targetTmpl *template
+	dataTmpl   *template
+	stats      archerStats
+	// latency histogram shared by all workers
+	latency *histogram
+}
+
+// newEndpoint validates e and merges query parameters into its url
+func newEndpoint(e Endpoint, query url.Values) (*endpoint, error) {
+	// url is kept as is, so template variables are not escaped
+	target := e.URL
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + query.Encode()
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	targetTmpl, err := parseTemplate(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetTmpl.IsStatic() {
+		targetTmpl = nil
+	}
+	dataTmpl, err := parseTemplate(e.Body)
+	if err != nil {
+		return nil, err
+	}
+	if dataTmpl.IsStatic() {
+		dataTmpl = nil
+	}
+	method := strings.ToUpper(e.Method)
+	if len(method) == 0 {
+		method = "PUT"
+	}
+	if (method == "GET" || method == "HEAD") && len(e.Body) > 0 {
+		return nil, errors.New("request body is not allowed for " + method)
+	}
+	weight := e.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	return &endpoint{
+		target:     target,
+		host:       u.Host,
+		method:     method,
+		data:       []byte(e.Body),
+		weight:     weight,
+		targetTmpl: targetTmpl,
+		dataTmpl:   dataTmpl,
+		latency:    newHistogram(),
+	}, nil
+}
+
+func (e *endpoint) String() string {
+	return e.method + " " + e.target
+}
+
+// endpointPicker picks endpoints randomly in proportion to their weights,
+// it is not safe for concurrent use, each worker owns one.
+type endpointPicker struct {
+	rnd *rand.Rand
+	// cumulative weights of endpoints
+	cum   []uint
+	total uint
+}
+
+func newEndpointPicker(endpoints []*endpoint, rnd *rand.Rand) *endpointPicker {
+	p := &endpointPicker{
+		rnd: rnd,
+		cum: make([]uint, len(endpoints)),
+	}
+	for i, e := range endpoints {
+		p.total += e.weight
+		p.cum[i] = p.total
+	}
+	return p
+}
+
+// Pick returns the index of next endpoint
+func (p *endpointPicker) Pick() int {
+	if len(p.cum) == 1 {
+		return 0
+	}
+	n := uint(p.rnd.Int63n(int64(p.total)))
+	for i, c := range p.cum {
+		if n < c {
+			return i
+		}
+	}
+	return len(p.cum) - 1
+}
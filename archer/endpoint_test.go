@@ -0,0 +1,87 @@
+package archer
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadEndpoints(t *testing.T) {
+	var tests = []struct {
+		s   string
+		e   []Endpoint
+		err bool
+	}{
+		{
+			`
+- url: http://127.0.0.1:8080/items
+  method: GET
+  weight: 9
+- url: http://127.0.0.1:8080/items
+  method: POST
+  body: '{"name": "stress"}'
+`,
+			[]Endpoint{
+				{URL: "http://127.0.0.1:8080/items", Method: "GET", Weight: 9},
+				{URL: "http://127.0.0.1:8080/items", Method: "POST", Body: `{"name": "stress"}`},
+			},
+			false,
+		},
+		{
+			`[{"url": "http://127.0.0.1:8080", "weight": 2}]`,
+			[]Endpoint{{URL: "http://127.0.0.1:8080", Weight: 2}},
+			false,
+		},
+		{
+			`[]`,
+			nil,
+			true,
+		},
+		{
+			`url: http://127.0.0.1:8080`,
+			nil,
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		f, err := ioutil.TempFile("", "endpoints")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		f.WriteString(c.s)
+		f.Close()
+		res, err := LoadEndpoints(f.Name())
+		os.Remove(f.Name())
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+		}
+		if !reflect.DeepEqual(res, c.e) {
+			t.Errorf("case #%d, result incorrect: %v", caseid+1, res)
+		}
+	}
+}
+
+func TestEndpointPicker(t *testing.T) {
+	endpoints := []*endpoint{{weight: 1}, {weight: 3}, {weight: 6}}
+	p := newEndpointPicker(endpoints, rand.New(rand.NewSource(1)))
+	counts := make([]int, len(endpoints))
+	for i := 0; i < 100000; i++ {
+		counts[p.Pick()]++
+	}
+	for i, e := range endpoints {
+		ratio := float64(counts[i]) / 100000
+		expect := float64(e.weight) / 10
+		if ratio < expect-0.01 || ratio > expect+0.01 {
+			t.Errorf("endpoint #%d, picked ratio incorrect: %v, expecting: %v", i+1, ratio, expect)
+		}
+	}
+}
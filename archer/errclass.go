@@ -0,0 +1,122 @@
+package archer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/valyala/fasthttp"
+)
+
+// errorClass is the category of a failed request
+type errorClass int
+
+const (
+	errOther errorClass = iota
+	errRefused
+	errReset
+	errTimeout
+	errDNS
+	errTLS
+	errTooManyConns
+	errBodyRead
+	errPortExhausted
+	errorClassNum
+)
+
+var errorClassNames = [errorClassNum]string{
+	errOther:         "other",
+	errRefused:       "connection refused",
+	errReset:         "reset by peer",
+	errTimeout:       "timeout",
+	errDNS:           "dns failure",
+	errTLS:           "tls handshake",
+	errTooManyConns:  "too many connections",
+	errBodyRead:      "body read",
+	errPortExhausted: "port exhaustion",
+}
+
+func (c errorClass) String() string {
+	return errorClassNames[c]
+}
+
+// classifyError returns the category of err, errors wrapped by fasthttp
+// only keep the message of the original error, so they are matched by
+// message as well.
+func classifyError(err error) errorClass {
+	if _, ok := err.(*handshakeError); ok {
+		return errTLS
+	}
+	switch err {
+	case fasthttp.ErrTimeout, fasthttp.ErrDialTimeout:
+		return errTimeout
+	case fasthttp.ErrNoFreeConns, fasthttp.ErrPipelineOverflow:
+		return errTooManyConns
+	case io.ErrUnexpectedEOF, fasthttp.ErrBodyTooLarge:
+		return errBodyRead
+	}
+	// DNS errors are checked first, a lookup timeout is a DNS failure
+	if oe, ok := err.(*net.OpError); ok {
+		if _, ok := oe.Err.(*net.DNSError); ok {
+			return errDNS
+		}
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		return errDNS
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return errTimeout
+	}
+	switch err.(type) {
+	case tls.RecordHeaderError, x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return errTLS
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "i/o timeout"):
+		return errTimeout
+	case strings.Contains(msg, "no such host"):
+		return errDNS
+	case strings.Contains(msg, syscall.ECONNREFUSED.Error()):
+		return errRefused
+	case strings.Contains(msg, syscall.ECONNRESET.Error()), strings.Contains(msg, syscall.EPIPE.Error()):
+		return errReset
+	case strings.Contains(msg, syscall.EMFILE.Error()):
+		return errTooManyConns
+	case strings.Contains(msg, syscall.EADDRNOTAVAIL.Error()), strings.Contains(msg, syscall.EADDRINUSE.Error()):
+		// no free local port of the source address
+		return errPortExhausted
+	case strings.HasPrefix(msg, "tls: "), strings.HasPrefix(msg, "x509: "),
+		strings.Contains(msg, "remote error: tls"):
+		return errTLS
+	case strings.Contains(msg, "chunk"):
+		return errBodyRead
+	}
+	return errOther
+}
+
+// formatErrors renders non-zero error counters by class, e.g.
+// "connection refused: 3, timeout: 1"
+func formatErrors(errs *[errorClassNum]uint64) string {
+	var b bytes.Buffer
+	for class, c := range errs {
+		if c == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(errorClass(class).String())
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatUint(c, 10))
+	}
+	if b.Len() == 0 {
+		return "none"
+	}
+	return b.String()
+}
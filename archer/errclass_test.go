@@ -0,0 +1,130 @@
+package archer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestClassifyError(t *testing.T) {
+	var tests = []struct {
+		err   error
+		class errorClass
+	}{
+		{
+			fasthttp.ErrTimeout,
+			errTimeout,
+		},
+		{
+			fasthttp.ErrDialTimeout,
+			errTimeout,
+		},
+		{
+			&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}},
+			errTimeout,
+		},
+		{
+			fmt.Errorf("error when reading response headers: %s", "read tcp 127.0.0.1:80: i/o timeout"),
+			errTimeout,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			errRefused,
+		},
+		{
+			&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			errReset,
+		},
+		{
+			&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)},
+			errReset,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "abc"}},
+			errDNS,
+		},
+		{
+			&net.DNSError{Err: "server misbehaving", Name: "abc"},
+			errDNS,
+		},
+		{
+			&net.DNSError{Err: "lookup timed out", Name: "abc", IsTimeout: true},
+			errDNS,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", Name: "abc", IsTimeout: true}},
+			errDNS,
+		},
+		{
+			tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"},
+			errTLS,
+		},
+		{
+			errors.New("x509: certificate signed by unknown authority"),
+			errTLS,
+		},
+		{
+			fasthttp.ErrNoFreeConns,
+			errTooManyConns,
+		},
+		{
+			fasthttp.ErrPipelineOverflow,
+			errTooManyConns,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)},
+			errTooManyConns,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EADDRNOTAVAIL)},
+			errPortExhausted,
+		},
+		{
+			&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EADDRINUSE)},
+			errPortExhausted,
+		},
+		{
+			io.ErrUnexpectedEOF,
+			errBodyRead,
+		},
+		{
+			fasthttp.ErrBodyTooLarge,
+			errBodyRead,
+		},
+		{
+			fasthttp.ErrConnectionClosed,
+			errOther,
+		},
+	}
+
+	for caseid, c := range tests {
+		if class := classifyError(c.err); class != c.class {
+			t.Errorf("case #%d, class incorrect: %v, expecting: %v", caseid+1, class, c.class)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestFormatErrors(t *testing.T) {
+	var errs [errorClassNum]uint64
+	if r := formatErrors(&errs); r != "none" {
+		t.Errorf("result incorrect: %s", r)
+	}
+	errs[errRefused] = 3
+	errs[errTimeout] = 1
+	if r := formatErrors(&errs); r != "connection refused: 3, timeout: 1" {
+		t.Errorf("result incorrect: %s", r)
+	}
+}
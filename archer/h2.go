@@ -0,0 +1,255 @@
+package archer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// h2Client sends requests over HTTP/2 connections, https targets are
+// negotiated with ALPN (h2) and http targets use prior knowledge (h2c).
+// Worker i sends requests as streams of connection i % connNum.
+type h2Client struct {
+	dialer    *dialer
+	tlsConfig *tls.Config
+	transport *http2.Transport
+	slots     []h2Slot
+	// connections of all slots, used to find connections marked dead
+	mu    sync.Mutex
+	conns map[*http2.ClientConn]*h2Conn
+}
+
+// h2Slot holds connections of a slot to each target host
+type h2Slot struct {
+	sync.Mutex
+	// signaled when a stream is finished or a connection is marked dead
+	cond  *sync.Cond
+	conns map[string]*h2Conn
+}
+
+// h2Conn is a connection of a slot, active and dead are guarded by the
+// slot lock
+type h2Conn struct {
+	conn net.Conn
+	cc   *http2.ClientConn
+	slot *h2Slot
+	// streams of workers in flight
+	active int
+	// connection got GOAWAY or is closed
+	dead bool
+}
+
+func newH2Client(d *dialer, tlsConfig *tls.Config, connNum int) *h2Client {
+	c := &h2Client{
+		dialer:    d,
+		tlsConfig: tlsConfig,
+		slots:     make([]h2Slot, connNum),
+		conns:     make(map[*http2.ClientConn]*h2Conn),
+	}
+	// the client is the pool of transport to learn about dead connections
+	c.transport = &http2.Transport{ConnPool: c}
+	for i := range c.slots {
+		c.slots[i].cond = sync.NewCond(&c.slots[i])
+		c.slots[i].conns = make(map[string]*h2Conn)
+	}
+	return c
+}
+
+// GetClientConn implements http2.ClientConnPool, requests are sent on
+// connections of slots directly so it is never used
+func (c *h2Client) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	return nil, errors.New("http2 client connection pool is not used")
+}
+
+// MarkDead implements http2.ClientConnPool, it is called by transport
+// when cc gets GOAWAY or is closed
+func (c *h2Client) MarkDead(cc *http2.ClientConn) {
+	c.mu.Lock()
+	hc := c.conns[cc]
+	delete(c.conns, cc)
+	c.mu.Unlock()
+	if hc == nil {
+		return
+	}
+	hc.slot.Lock()
+	hc.dead = true
+	hc.slot.Unlock()
+	hc.slot.cond.Broadcast()
+}
+
+// acquire returns connection of slot to req target and counts a stream of
+// it in flight, it must be released by release. Dead connections are
+// replaced by new ones and left to finish their streams, and a connection
+// which reached the stream limit of server is waited for.
+func (c *h2Client) acquire(slot int, req *fasthttp.Request) (*h2Conn, error) {
+	host, isTLS, err := targetHost(req)
+	if err != nil {
+		return nil, err
+	}
+	key := string(host)
+	if isTLS {
+		key = "https://" + key
+	}
+	s := &c.slots[slot]
+	s.Lock()
+	defer s.Unlock()
+	for {
+		hc := s.conns[key]
+		if hc != nil && hc.dead {
+			delete(s.conns, key)
+			hc = nil
+		}
+		if hc == nil {
+			if hc, err = c.dial(s, string(host), isTLS); err != nil {
+				return nil, err
+			}
+			s.conns[key] = hc
+		}
+		if hc.cc.CanTakeNewRequest() {
+			hc.active++
+			return hc, nil
+		}
+		if hc.active == 0 {
+			// not usable with no stream to wait for, e.g. stream IDs
+			// are exhausted
+			hc.conn.Close()
+			delete(s.conns, key)
+			continue
+		}
+		s.cond.Wait()
+	}
+}
+
+// release finishes a stream of hc acquired by acquire
+func (c *h2Client) release(hc *h2Conn) {
+	hc.slot.Lock()
+	hc.active--
+	hc.slot.Unlock()
+	hc.slot.cond.Broadcast()
+}
+
+func (c *h2Client) dial(s *h2Slot, host string, isTLS bool) (*h2Conn, error) {
+	addr := hostAddr(host, isTLS)
+	var (
+		conn net.Conn
+		err  error
+	)
+	if isTLS {
+		cfg := serverTLSConfig(c.tlsConfig, addr)
+		cfg.NextProtos = []string{http2.NextProtoTLS}
+		if conn, err = c.dialer.DialTLS(addr, cfg); err != nil {
+			return nil, err
+		}
+		if p := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+			conn.Close()
+			return nil, errors.New("server does not support HTTP/2, negotiated protocol: " + p)
+		}
+	} else if conn, err = c.dialer.Dial(addr); err != nil {
+		return nil, err
+	}
+	cc, err := c.transport.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	hc := &h2Conn{conn: conn, cc: cc, slot: s}
+	c.mu.Lock()
+	c.conns[cc] = hc
+	c.mu.Unlock()
+	return hc, nil
+}
+
+// errH2ConnUnusable is returned by RoundTrip of a connection which can not
+// take new streams, the vendored transport does not export it
+const errH2ConnUnusable = "http2: client conn not usable"
+
+// Do sends req as a stream of the connection of worker and fills res
+func (c *h2Client) Do(worker int, req *fasthttp.Request, res *fasthttp.Response, timeout time.Duration) error {
+	hreq, err := newH2Request(req)
+	if err != nil {
+		return err
+	}
+	var timedOut uint32
+	if timeout > 0 {
+		cancel := make(chan struct{})
+		hreq.Cancel = cancel
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreUint32(&timedOut, 1)
+			close(cancel)
+		})
+		defer timer.Stop()
+	}
+	for {
+		var hc *h2Conn
+		hc, err = c.acquire(worker%len(c.slots), req)
+		if err != nil {
+			return err
+		}
+		var hres *http.Response
+		hres, err = hc.cc.RoundTrip(hreq)
+		if err == nil {
+			err = readH2Response(hres, res)
+		}
+		c.release(hc)
+		// another slot user took the last stream, wait for a new one
+		if err == nil || err.Error() != errH2ConnUnusable {
+			break
+		}
+	}
+	if err != nil && atomic.LoadUint32(&timedOut) == 1 {
+		return fasthttp.ErrTimeout
+	}
+	return err
+}
+
+// newH2Request converts req to http.Request, connection specific headers
+// are not allowed in HTTP/2 and skipped
+func newH2Request(req *fasthttp.Request) (*http.Request, error) {
+	body := req.Body()
+	hreq, err := http.NewRequest(string(req.Header.Method()), string(req.URI().FullURI()), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Host = string(req.Host())
+	hreq.ContentLength = int64(len(body))
+	req.Header.VisitAll(func(k, v []byte) {
+		switch http.CanonicalHeaderKey(string(k)) {
+		case "Host", "Content-Length", "Connection", "Transfer-Encoding", "Keep-Alive", "Upgrade":
+			return
+		}
+		hreq.Header.Add(string(k), string(v))
+	})
+	return hreq, nil
+}
+
+// readH2Response reads hres into res
+func readH2Response(hres *http.Response, res *fasthttp.Response) error {
+	defer hres.Body.Close()
+	res.Reset()
+	res.SetStatusCode(hres.StatusCode)
+	for k, vs := range hres.Header {
+		for _, v := range vs {
+			switch k {
+			case "Content-Length":
+			case "Content-Type":
+				res.Header.SetContentType(v)
+			default:
+				res.Header.Add(k, v)
+			}
+		}
+	}
+	if _, err := io.Copy(res.BodyWriter(), hres.Body); err != nil {
+		return err
+	}
+	res.Header.SetContentLength(len(res.Body()))
+	return nil
+}
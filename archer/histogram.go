@@ -0,0 +1,176 @@
+package archer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// histogram bucket layout, values below subBucketCount are recorded exactly,
+// larger values are grouped into power of two ranges, each split into
+// subBucketHalf linear sub buckets, relative error is under 1/subBucketHalf.
+// Values are tracked up to maxValue (about 73 minutes in nanoseconds),
+// larger ones fall into the last bucket.
+const (
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+	maxValueBits   = 42
+	maxValue       = 1<<maxValueBits - 1
+	bucketNum      = subBucketCount + (maxValueBits-subBucketBits)*subBucketHalf
+)
+
+// histogram is a log-linear (HDR style) latency histogram.
+// Recording is lock free, so each worker can own one histogram
+// and readers merge them on demand.
+type histogram struct {
+	counts [bucketNum]uint64
+	count  uint64
+	sum    uint64
+	min    uint64
+	max    uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{min: ^uint64(0)}
+}
+
+// bucketIndex returns the index of bucket which value v falls into
+func bucketIndex(v uint64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	if v > maxValue {
+		v = maxValue
+	}
+	shift := uint(0)
+	for (v >> shift) >= subBucketCount {
+		shift++
+	}
+	return subBucketCount + int(shift-1)*subBucketHalf + int(v>>shift) - subBucketHalf
+}
+
+// bucketValue returns the highest value which is recorded into bucket idx
+func bucketValue(idx int) uint64 {
+	if idx < subBucketCount {
+		return uint64(idx)
+	}
+	shift := uint((idx-subBucketCount)/subBucketHalf + 1)
+	m := uint64((idx-subBucketCount)%subBucketHalf + subBucketHalf)
+	return ((m + 1) << shift) - 1
+}
+
+// Record adds a duration to histogram, negative durations are counted as 0
+func (h *histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	v := uint64(d)
+	atomic.AddUint64(&h.counts[bucketIndex(v)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, v)
+	for {
+		min := atomic.LoadUint64(&h.min)
+		if v >= min || atomic.CompareAndSwapUint64(&h.min, min, v) {
+			break
+		}
+	}
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if v <= max || atomic.CompareAndSwapUint64(&h.max, max, v) {
+			break
+		}
+	}
+}
+
+// Merge adds all recorded values in o to h
+func (h *histogram) Merge(o *histogram) {
+	for i := range o.counts {
+		if c := atomic.LoadUint64(&o.counts[i]); c > 0 {
+			atomic.AddUint64(&h.counts[i], c)
+		}
+	}
+	atomic.AddUint64(&h.count, atomic.LoadUint64(&o.count))
+	atomic.AddUint64(&h.sum, atomic.LoadUint64(&o.sum))
+	if min := atomic.LoadUint64(&o.min); min < atomic.LoadUint64(&h.min) {
+		atomic.StoreUint64(&h.min, min)
+	}
+	if max := atomic.LoadUint64(&o.max); max > atomic.LoadUint64(&h.max) {
+		atomic.StoreUint64(&h.max, max)
+	}
+}
+
+// Sub returns a new histogram of values recorded in h but not in o,
+// o must be an earlier snapshot of h. Min and max of result are
+// approximated by bucket boundaries.
+func (h *histogram) Sub(o *histogram) *histogram {
+	ret := newHistogram()
+	for i := range h.counts {
+		c := atomic.LoadUint64(&h.counts[i]) - atomic.LoadUint64(&o.counts[i])
+		if c == 0 {
+			continue
+		}
+		ret.counts[i] = c
+		if v := bucketValue(i); v < ret.min {
+			ret.min = v
+		}
+		ret.max = bucketValue(i)
+	}
+	ret.count = h.Count() - o.Count()
+	ret.sum = atomic.LoadUint64(&h.sum) - atomic.LoadUint64(&o.sum)
+	return ret
+}
+
+func (h *histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *histogram) Min() time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&h.min))
+}
+
+func (h *histogram) Max() time.Duration {
+	return time.Duration(atomic.LoadUint64(&h.max))
+}
+
+func (h *histogram) Mean() time.Duration {
+	c := h.Count()
+	if c == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&h.sum) / c)
+}
+
+// Percentile returns the value at percentile p (0-100)
+func (h *histogram) Percentile(p float64) time.Duration {
+	c := h.Count()
+	if c == 0 {
+		return 0
+	}
+	target := uint64(p/100*float64(c) + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var seen uint64
+	for i := range h.counts {
+		seen += atomic.LoadUint64(&h.counts[i])
+		if seen >= target {
+			v := time.Duration(bucketValue(i))
+			if max := h.Max(); v > max {
+				return max
+			}
+			return v
+		}
+	}
+	return h.Max()
+}
+
+// String returns the summary of latency distribution
+func (h *histogram) String() string {
+	return fmt.Sprintf("Min: %v, Mean: %v, P50: %v, P90: %v, P99: %v, P99.9: %v, Max: %v",
+		h.Min(), h.Mean(), h.Percentile(50), h.Percentile(90),
+		h.Percentile(99), h.Percentile(99.9), h.Max())
+}
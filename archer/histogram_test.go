@@ -0,0 +1,65 @@
+package archer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 123456789, 1 << 40, maxValue} {
+		idx := bucketIndex(v)
+		if idx < 0 || idx >= bucketNum {
+			t.Errorf("value %v, index out of range: %v", v, idx)
+			continue
+		}
+		upper := bucketValue(idx)
+		if upper < v {
+			t.Errorf("value %v, bucket upper bound too small: %v", v, upper)
+		}
+		if v >= subBucketCount && float64(upper-v)/float64(v) > 1.0/subBucketHalf {
+			t.Errorf("value %v, bucket upper bound too large: %v", v, upper)
+		}
+	}
+	// values beyond tracked range fall into the last bucket
+	for _, v := range []uint64{maxValue + 1, 1 << 50, ^uint64(0)} {
+		if idx := bucketIndex(v); idx != bucketNum-1 {
+			t.Errorf("value %v, index incorrect: %v", v, idx)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	var tests = []struct {
+		p float64
+		e time.Duration
+	}{
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{100, 1000 * time.Millisecond},
+	}
+	for caseid, c := range tests {
+		r := h.Percentile(c.p)
+		if r < c.e || float64(r-c.e)/float64(c.e) > 1.0/subBucketHalf {
+			t.Errorf("case #%d, p%v incorrect: %v, expecting: %v", caseid+1, c.p, r, c.e)
+		}
+	}
+	if h.Min() != time.Millisecond || h.Max() != time.Second {
+		t.Errorf("min/max incorrect: %v/%v", h.Min(), h.Max())
+	}
+	if h.Mean() != 500500*time.Microsecond {
+		t.Errorf("mean incorrect: %v", h.Mean())
+	}
+
+	m := newHistogram()
+	m.Merge(h)
+	m.Merge(newHistogram())
+	if m.Count() != 1000 || m.Min() != h.Min() || m.Max() != h.Max() {
+		t.Errorf("merge incorrect: %v", m)
+	}
+	t.Logf("Result: %v", m)
+}
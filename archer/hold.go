@@ -0,0 +1,167 @@
+package archer
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/context"
+)
+
+// holdStats counts connections of hold mode, connections still held
+// are opened - closed
+type holdStats struct {
+	// connections opened successfully
+	opened uint64
+	// connections closed by peer or failed pings
+	closed uint64
+}
+
+// Held returns the number of connections still held
+func (s *holdStats) Held() uint64 {
+	closed := atomic.LoadUint64(&s.closed)
+	return atomic.LoadUint64(&s.opened) - closed
+}
+
+// Hold opens h.hold idle keep-alive connections to the first endpoint,
+// connNum openers dial them at holdRate per second, or as fast as
+// they can if holdRate is 0. Connections are held until ctx is done,
+// a request is sent on each of them every pingInterval if it is not 0.
+func (h *httpArcher) Hold(ctx context.Context) error {
+	req := h.newRequest(h.endpoints[0])
+	host, isTLS, err := targetHost(req)
+	if err != nil {
+		return err
+	}
+	addr := hostAddr(string(host), isTLS)
+	dial := h.dialer.Dial
+	if isTLS {
+		cfg := serverTLSConfig(h.tlsConfig, addr)
+		dial = func(addr string) (net.Conn, error) {
+			return h.dialer.DialTLS(addr, cfg)
+		}
+	}
+
+	var (
+		tickets chan ticket
+		count   uint64
+		wg      sync.WaitGroup
+		held    sync.WaitGroup
+	)
+	if h.holdRate > 0 {
+		tickets = make(chan ticket, h.connNum)
+		go schedule(ctx, profile{{From: h.holdRate, To: h.holdRate, Duration: forever}}, time.Now(), tickets)
+	}
+	for i := 0; i < h.connNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.AddUint64(&count, 1) <= uint64(h.hold) {
+				if tickets != nil {
+					select {
+					case <-tickets:
+					case <-ctx.Done():
+						return
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				conn, err := dial(addr)
+				if err != nil {
+					class := classifyError(err)
+					if h.printErr {
+						log.Printf("dial err (%v): %s", class, err)
+					}
+					h.stats.addError(class)
+					continue
+				}
+				atomic.AddUint64(&h.holdStats.opened, 1)
+				held.Add(1)
+				go func() {
+					defer held.Done()
+					h.holdConn(ctx, conn, req)
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+	<-ctx.Done()
+	held.Wait()
+	return nil
+}
+
+// holdConn keeps conn open until ctx is done, or it is closed by peer
+// or a ping fails.
+func (h *httpArcher) holdConn(ctx context.Context, conn net.Conn, req *fasthttp.Request) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock pending read or write
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	defer conn.Close()
+
+	if h.pingInterval <= 0 {
+		// nothing is expected from peer, read returns once it is closed
+		var b [1]byte
+		conn.Read(b[:])
+		if ctx.Err() == nil {
+			h.closeHeld("connection closed by peer")
+		}
+		return
+	}
+
+	// request is shared by all connections, so each one writes a copy
+	ping := &fasthttp.Request{}
+	req.CopyTo(ping)
+	size := uint64(len(ping.Body()))
+	res := &fasthttp.Response{}
+	br := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+	for sleep(ctx, h.pingInterval) {
+		start := time.Now()
+		if h.requestTimeout > 0 {
+			conn.SetDeadline(start.Add(h.requestTimeout))
+		}
+		err := ping.Write(bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err == nil {
+			err = res.Read(br)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			class := classifyError(err)
+			h.stats.addError(class)
+			h.closeHeld("ping err (" + class.String() + "): " + err.Error())
+			return
+		}
+		h.latency[0].Record(time.Since(start))
+		code := res.StatusCode()
+		h.stats.addResponse(code, h.successStatus.Contains(code), size, uint64(len(res.Body())))
+		if res.ConnectionClose() {
+			h.closeHeld("connection closed by peer")
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+}
+
+// closeHeld counts a held connection closed before the end of hold
+func (h *httpArcher) closeHeld(reason string) {
+	if h.printErr {
+		log.Printf("held connection lost: %s", reason)
+	}
+	atomic.AddUint64(&h.holdStats.closed, 1)
+}
@@ -4,94 +4,383 @@ package archer provides the stress client for performance testing
 package archer
 
 import (
+	"crypto/tls"
+	"errors"
 	"log"
-	"net/url"
+	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/valyala/fasthttp"
+	"golang.org/x/net/context"
 )
 
-type archerStats struct {
-	sentBytes     uint64
-	receivedBytes uint64
-	succeeded     uint64
-	failed        uint64
-}
-
 type httpArcher struct {
-	stats    archerStats
+	stats archerStats
+	// sequence of {{seq}} template variable
+	seq      uint64
 	printErr bool
 	printLog bool
-	target   string
-	host     string
-	interval time.Duration
-	connNum  int
-	num      uint64
-	data     []byte
-	sighup   chan os.Signal
+	// requests are sent to endpoints in proportion to their weights
+	endpoints []*endpoint
+	headers   []Header
+	// header value templates, nil for headers without variables
+	headerTmpls []*template
+	interval    time.Duration
+	// run duration, 0 means non-stop
+	duration time.Duration
+	// request, read and write timeouts, 0 means no timeout
+	requestTimeout time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	dialer         *dialer
+	tlsConfig      *tls.Config
+	rate           uint64
+	profile        profile
+	// profile unit, ProfileUnitRate or ProfileUnitConn
+	unit    string
+	connNum int
+	// send requests over HTTP/2 with streams workers sharing each connection
+	http2   bool
+	streams int
+	// pipelined requests per HTTP/1.1 connection, 0 means no pipelining
+	pipeline int
+	// number of workers, connNum * streams or connNum * pipeline
+	workers int
+	// requests sent by a worker before closing its connection, 0 means
+	// connections are kept alive
+	connRequests uint64
+	connLifetime time.Duration
+	// idle connections held instead of sending requests, 0 disables it
+	hold         int
+	holdRate     uint64
+	pingInterval time.Duration
+	holdStats    holdStats
+	num          uint64
+	sighup       chan os.Signal
+	// start time of Run, used to calculate connections per second
+	started time.Time
+	// per worker latency histograms
+	latency []*histogram
+	// per worker schedule lag histograms, nil unless requests are scheduled
+	lag []*histogram
+	// status codes counted as success
+	successStatus *statusCodes
+	// response assertions checked on successful responses
+	assertions    []assertion
+	assertSamples assertSamples
+	sampleFile    string
+	// captured requests to replay instead of sending to endpoints
+	records []*replayRecord
+	// replay speed, 0 means as fast as possible
+	speed          float64
+	replayFailures replayFailures
 }
 
-func (h *httpArcher) Launch() error {
+func (h *httpArcher) Launch(ctx context.Context) error {
 	var (
 		count uint64
 		wg    sync.WaitGroup
 	)
-	client := &fasthttp.Client{
-		MaxConnsPerHost:               h.connNum,
-		DisableHeaderNamesNormalizing: true,
+	var client doer
+	if h.http2 {
+		client = newH2Client(h.dialer, h.tlsConfig, h.connNum)
+	} else {
+		client = newClient(h.dialer, h.tlsConfig, h.connNum, h.pipeline, h.readTimeout, h.writeTimeout, h.connLifetime)
 	}
 
-	for i := 0; i < h.connNum; i++ {
+	// cancelled once all workers are finished
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// interrupt requests in flight once stopped, responses may never come
+	// without request timeout
+	go func() {
+		<-ctx.Done()
+		h.dialer.CloseAll()
+	}()
+
+	var tickets chan ticket
+	launched := time.Now()
+	if h.records != nil {
+		tickets = make(chan ticket, h.workers)
+		go replay(ctx, h.records, h.speed, launched, tickets)
+	} else if h.unit == ProfileUnitRate && h.profile != nil {
+		tickets = make(chan ticket, h.workers)
+		go schedule(ctx, h.profile, launched, tickets)
+	} else if h.rate > 0 {
+		tickets = make(chan ticket, h.workers)
+		go schedule(ctx, profile{{From: h.rate, To: h.rate, Duration: forever}}, launched, tickets)
+	}
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		if h.profile != nil {
+			h.ReportStages(ctx, launched)
+		}
+	}()
+
+	for i := 0; i < h.workers; i++ {
 		wg.Add(1)
-		go func() {
+		go func(id int) {
 			defer wg.Done()
+			h.work(ctx, id, client, tickets, launched, &count)
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+	<-reported
+	return nil
+}
 
-			req := &fasthttp.Request{}
-			req.SetBody(h.data)
-			req.SetHost(h.host)
-			req.SetRequestURI(h.target)
-			req.Header.SetMethod("PUT")
-			req.Header.SetContentLength(len(h.data))
-			size := req.Header.ContentLength() + req.Header.Len()
+// work is the request loop of worker id, requests are paced by tickets if
+// it is not nil, otherwise by interval. count is the number of requests
+// sent by all workers.
+func (h *httpArcher) work(ctx context.Context, id int, client doer,
+	tickets <-chan ticket, launched time.Time, count *uint64) {
+	reqs := make([]*fasthttp.Request, len(h.endpoints))
+	for j, e := range h.endpoints {
+		reqs[j] = h.newRequest(e)
+	}
+	rnd := rand.New(rand.NewSource(launched.UnixNano() + int64(id)))
+	picker := newEndpointPicker(h.endpoints, rnd)
+	tctx := &templateCtx{rnd: rnd, worker: id, seq: &h.seq}
+	var (
+		buf []byte
+		// requests sent by this worker
+		requests uint64
+		// copy of shared replay request, churn options modify the
+		// Connection header of requests sent
+		replayReq *fasthttp.Request
+	)
 
-			res := &fasthttp.Response{}
-			for {
-				time.Sleep(h.interval)
-				// total number finished
-				if h.num > 0 {
-					if atomic.LoadUint64(&count) >= h.num {
-						return
-					}
-					atomic.AddUint64(&count, 1)
+	res := &fasthttp.Response{}
+	for {
+		if h.unit == ProfileUnitConn && h.profile != nil {
+			stage, level := h.profile.At(time.Since(launched))
+			if stage >= len(h.profile) {
+				return
+			}
+			// connection of this worker is not active at current load level
+			if float64(id%h.connNum) >= level {
+				if !sleep(ctx, idleCheckInterval) {
+					return
+				}
+				continue
+			}
+		}
+		t := ticket{record: -1}
+		if tickets != nil {
+			var ok bool
+			select {
+			case t, ok = <-tickets:
+				if !ok {
+					return
 				}
+			case <-ctx.Done():
+				return
+			}
+		} else if !sleep(ctx, h.interval) {
+			return
+		}
+		// total number finished
+		if h.num > 0 {
+			if atomic.LoadUint64(count) >= h.num {
+				return
+			}
+			atomic.AddUint64(count, 1)
+		}
 
-				if err := client.Do(req, res); err != nil {
-					if h.printErr {
-						log.Printf("client DO err: %s", err)
-					}
-					atomic.AddUint64(&h.stats.failed, 1)
-					continue
+		var (
+			req *fasthttp.Request
+			e   *endpoint
+		)
+		if t.record >= 0 {
+			req = h.records[t.record].req
+			if h.connRequests > 0 || h.connLifetime > 0 {
+				if replayReq == nil {
+					replayReq = &fasthttp.Request{}
 				}
-				atomic.AddUint64(&h.stats.succeeded, 1)
-				atomic.AddUint64(&h.stats.sentBytes, uint64(size))
-				atomic.AddUint64(&h.stats.receivedBytes, uint64(res.Header.Len()))
-				atomic.AddUint64(&h.stats.receivedBytes, uint64(res.Header.ContentLength()))
+				req.CopyTo(replayReq)
+				req = replayReq
 			}
-		}()
+		} else {
+			idx := picker.Pick()
+			e = h.endpoints[idx]
+			if e.targetTmpl != nil || e.dataTmpl != nil || len(h.headerTmpls) > 0 {
+				buf = h.render(reqs[idx], e, tctx, buf)
+			}
+			req = reqs[idx]
+		}
+		if h.connRequests > 0 {
+			requests++
+			if requests%h.connRequests == 0 {
+				req.Header.SetConnectionClose()
+			} else {
+				req.Header.ResetConnectionClose()
+			}
+		}
+
+		start := time.Now()
+		sentAt := start
+		if !t.intended.IsZero() {
+			// measure from intended send time to correct coordinated omission
+			h.lag[id].Record(start.Sub(t.intended))
+			start = t.intended
+		}
+		err := client.Do(id, req, res, h.requestTimeout)
+		if err != nil && ctx.Err() != nil {
+			// interrupted by stopping archer
+			return
+		}
+		latency := time.Since(start)
+		if err != nil {
+			class := h.classify(err, time.Since(sentAt))
+			if h.printErr {
+				log.Printf("client DO err (%v): %s", class, err)
+			}
+			h.stats.addError(class)
+			if e != nil {
+				e.stats.addError(class)
+			}
+			if t.record >= 0 {
+				h.replayFailures.Add(t.record, err)
+			}
+			continue
+		}
+		// only requests got a response are counted in latency, failures
+		// like timeouts and refused connections would skew it
+		h.latency[id].Record(latency)
+		if e != nil {
+			e.latency.Record(latency)
+		}
+		code := res.StatusCode()
+		success := h.successStatus.Contains(code)
+		var aerr error
+		if success {
+			aerr = h.check(res)
+			success = aerr == nil
+		}
+		sent := uint64(len(req.Body()))
+		received := uint64(len(res.Body()))
+		h.stats.addResponse(code, success, sent, received)
+		if e != nil {
+			e.stats.addResponse(code, success, sent, received)
+		}
+		if aerr != nil {
+			if h.printErr {
+				log.Printf("assertion err: %s", aerr)
+			}
+			h.stats.addAssertFailed()
+			if e != nil {
+				e.stats.addAssertFailed()
+			}
+			h.assertSamples.Add(req, res, aerr)
+		}
+		if !success && t.record >= 0 {
+			if aerr == nil {
+				aerr = errors.New("status " + strconv.Itoa(code))
+			}
+			h.replayFailures.Add(t.record, aerr)
+		}
+	}
+}
+
+// classify returns the category of err of a request failed after elapsed.
+// fasthttp reports a read timeout before the first response byte as closed
+// connection, so such failures taking longer than read timeout are counted
+// as timeout.
+func (h *httpArcher) classify(err error, elapsed time.Duration) errorClass {
+	if err == fasthttp.ErrConnectionClosed && h.readTimeout > 0 && elapsed >= h.readTimeout {
+		return errTimeout
+	}
+	return classifyError(err)
+}
+
+// check returns the first assertion res failed, nil if all passed
+func (h *httpArcher) check(res *fasthttp.Response) error {
+	for _, a := range h.assertions {
+		if err := a(res); err != nil {
+			return err
+		}
 	}
-	wg.Wait()
 	return nil
 }
 
+// newRequest creates the request sent by workers to endpoint e
+func (h *httpArcher) newRequest(e *endpoint) *fasthttp.Request {
+	req := &fasthttp.Request{}
+	req.SetHost(e.host)
+	req.SetRequestURI(e.target)
+	req.Header.SetMethod(e.method)
+	setHeaders(req, h.headers)
+	// GET and HEAD requests can not carry body
+	if !req.Header.IsGet() && !req.Header.IsHead() {
+		req.SetBody(e.data)
+		req.Header.SetContentLength(len(e.data))
+	}
+	return req
+}
+
+// setHeaders sets headers to req, the first value of a key replaces the
+// default one like Content-Type or User-Agent, values repeating the key
+// are added after it.
+func setHeaders(req *fasthttp.Request, headers []Header) {
+	set := make(map[string]bool, len(headers))
+	for _, hd := range headers {
+		key := strings.ToLower(hd.Key)
+		if set[key] {
+			req.Header.Add(hd.Key, hd.Value)
+			continue
+		}
+		set[key] = true
+		req.Header.Set(hd.Key, hd.Value)
+	}
+}
+
+// render evaluates url, header and body templates of endpoint e into req,
+// buf is reused between requests to avoid allocation.
+func (h *httpArcher) render(req *fasthttp.Request, e *endpoint, c *templateCtx, buf []byte) []byte {
+	c.Next()
+	if e.targetTmpl != nil {
+		buf = e.targetTmpl.Execute(buf[:0], c)
+		req.SetRequestURIBytes(buf)
+	}
+	for i, t := range h.headerTmpls {
+		if t != nil {
+			buf = t.Execute(buf[:0], c)
+			req.Header.SetBytesV(h.headers[i].Key, buf)
+		}
+	}
+	if e.dataTmpl != nil {
+		buf = e.dataTmpl.Execute(buf[:0], c)
+		req.SetBody(buf)
+		req.Header.SetContentLength(len(buf))
+	}
+	return buf
+}
+
+// SentBytes returns bytes written to connections
 func (h *httpArcher) SentBytes() uint64 {
-	return atomic.LoadUint64(&h.stats.sentBytes)
+	return atomic.LoadUint64(&h.dialer.sent)
 }
 
+// ReceivedBytes returns bytes read from connections
 func (h *httpArcher) ReceivedBytes() uint64 {
-	return atomic.LoadUint64(&h.stats.receivedBytes)
+	return atomic.LoadUint64(&h.dialer.received)
+}
+
+// SentPayload returns body size of requests sent
+func (h *httpArcher) SentPayload() uint64 {
+	return atomic.LoadUint64(&h.stats.sentPayload)
+}
+
+// ReceivedPayload returns body size of responses received
+func (h *httpArcher) ReceivedPayload() uint64 {
+	return atomic.LoadUint64(&h.stats.receivedPayload)
 }
 
 func (h *httpArcher) Succeeded() uint64 {
@@ -102,31 +391,324 @@ func (h *httpArcher) Failed() uint64 {
 	return atomic.LoadUint64(&h.stats.failed)
 }
 
-// Start HTTP archer by providing archer configurations
-func StartHTTPArcher(cfg Config) error {
-	u, err := url.Parse(cfg.Target)
+// Latency returns the merged latency histogram of all workers
+func (h *httpArcher) Latency() *histogram {
+	ret := newHistogram()
+	for _, l := range h.latency {
+		ret.Merge(l)
+	}
+	return ret
+}
+
+// Lag returns the merged schedule lag histogram of all workers
+func (h *httpArcher) Lag() *histogram {
+	ret := newHistogram()
+	for _, l := range h.lag {
+		ret.Merge(l)
+	}
+	return ret
+}
+
+// snapshot returns current counters and latency distribution
+func (h *httpArcher) snapshot() statsSnapshot {
+	connect := newHistogram()
+	connect.Merge(h.dialer.connect)
+	return statsSnapshot{
+		archerStats:   h.stats.Load(),
+		latency:       h.Latency(),
+		connect:       connect,
+		sentBytes:     h.SentBytes(),
+		receivedBytes: h.ReceivedBytes(),
+	}
+}
+
+// ReportStages prints stats of each load profile stage once it is finished,
+// it returns after the last stage or when ctx is done.
+func (h *httpArcher) ReportStages(ctx context.Context, start time.Time) {
+	last := h.snapshot()
+	end := start
+	for i, stage := range h.profile {
+		end = end.Add(stage.Duration)
+		finished := false
+		select {
+		case <-time.After(end.Sub(time.Now())):
+		case <-ctx.Done():
+			finished = true
+		}
+		cur := h.snapshot()
+		diff := cur.Sub(last)
+		log.Printf("Stage #%d (%v %s) Sent Bytes: %v, Received Bytes: %v, Sent Payload: %v, Received Payload: %v, Succeeded: %v, Failed: %v",
+			i+1, stage, h.unit, diff.sentBytes, diff.receivedBytes, diff.sentPayload, diff.receivedPayload, diff.succeeded, diff.failed)
+		log.Printf("Stage #%d Status %s", i+1, formatStatus(&diff.status))
+		log.Printf("Stage #%d Errors %s", i+1, formatErrors(&diff.errors))
+		if len(h.assertions) > 0 {
+			log.Printf("Stage #%d Assertion Failed: %v", i+1, diff.assertFailed)
+		}
+		log.Printf("Stage #%d Latency %v", i+1, diff.latency)
+		log.Printf("Stage #%d Connections: %v, CPS: %.1f, Connect %v", i+1,
+			diff.connect.Count(), float64(diff.connect.Count())/stage.Duration.Seconds(), diff.connect)
+		if finished {
+			return
+		}
+		last = cur
+	}
+}
+
+// Start HTTP archer by providing archer configurations,
+// it runs until ctx is done, Num requests are sent, Duration is passed
+// or the load profile is finished.
+func StartHTTPArcher(ctx context.Context, cfg Config) error {
+	archer, err := newHTTPArcher(cfg)
 	if err != nil {
 		return err
 	}
+	return archer.Run(ctx)
+}
+
+// newHTTPArcher validates cfg and creates the archer
+func newHTTPArcher(cfg Config) (*httpArcher, error) {
+	eps := cfg.Endpoints
+	if len(eps) == 0 {
+		eps = []Endpoint{{
+			URL:    cfg.Target,
+			Method: cfg.Method,
+			Body:   string(cfg.Data),
+		}}
+	}
+	endpoints := make([]*endpoint, len(eps))
+	for i, e := range eps {
+		ep, err := newEndpoint(e, cfg.Query)
+		if err != nil {
+			return nil, err
+		}
+		endpoints[i] = ep
+	}
+	var headerTmpls []*template
+	for i, hd := range cfg.Headers {
+		t, err := parseTemplate(hd.Value)
+		if err != nil {
+			return nil, err
+		}
+		if t.IsStatic() {
+			continue
+		}
+		if headerTmpls == nil {
+			headerTmpls = make([]*template, len(cfg.Headers))
+		}
+		headerTmpls[i] = t
+	}
+	var assertions []assertion
+	for _, raw := range cfg.Assertions {
+		a, err := parseAssertion(raw)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+	samples := cfg.AssertSamples
+	if samples == 0 {
+		samples = DefaultAssertSamples
+	} else if samples < 0 {
+		samples = 0
+	}
+	if headerTmpls != nil && len(cfg.Replay) > 0 {
+		return nil, errors.New("header templates are not supported in replay")
+	}
+	var records []*replayRecord
+	for _, r := range cfg.Replay {
+		records = append(records, newReplayRecord(r, cfg.Headers))
+	}
+	success := cfg.SuccessStatus
+	if len(success) == 0 {
+		success = DefaultSuccessStatus
+	}
+	successStatus, err := parseStatusCodes(success)
+	if err != nil {
+		return nil, err
+	}
 	interval, err := time.ParseDuration(cfg.Interval)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	duration, err := parseOptionalDuration(cfg.Duration)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout, err := parseOptionalDuration(cfg.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := parseOptionalDuration(cfg.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	readTimeout, err := parseOptionalDuration(cfg.ReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	writeTimeout, err := parseOptionalDuration(cfg.WriteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := parseSources(cfg.Sources)
+	if err != nil {
+		return nil, err
+	}
+	resolve, err := parseResolve(cfg.Resolve)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.TLS.Load()
+	if err != nil {
+		return nil, err
+	}
+	var p profile
+	if len(cfg.Profile) > 0 {
+		if p, err = parseProfile(cfg.Profile); err != nil {
+			return nil, err
+		}
+	}
+	unit := cfg.ProfileUnit
+	if len(unit) == 0 {
+		unit = ProfileUnitRate
+	}
+	if unit != ProfileUnitRate && unit != ProfileUnitConn {
+		return nil, errors.New("invalid load profile unit: " + unit)
 	}
+	if p != nil && p.Max() == 0 {
+		return nil, errors.New("load profile has no load: " + cfg.Profile)
+	}
+	// one connection for each load level
+	if unit == ProfileUnitConn && p != nil {
+		if cfg.ConnNum != int(p.Max()) {
+			log.Printf("Load profile opens %d connections, connection number %d is ignored",
+				p.Max(), cfg.ConnNum)
+		}
+		cfg.ConnNum = int(p.Max())
+	}
+	streams := cfg.Streams
+	if streams == 0 {
+		streams = 1
+	}
+	if streams > 1 && !cfg.HTTP2 {
+		return nil, errors.New("multiple streams per connection requires HTTP/2")
+	}
+	if cfg.Pipeline > 0 && cfg.HTTP2 {
+		return nil, errors.New("pipelining is not supported by HTTP/2")
+	}
+	connLifetime, err := parseOptionalDuration(cfg.ConnLifetime)
+	if err != nil {
+		return nil, err
+	}
+	if (cfg.ConnRequests > 0 || connLifetime > 0) && (cfg.HTTP2 || cfg.Pipeline > 0) {
+		return nil, errors.New("connection churn requires HTTP/1.1 without pipelining")
+	}
+	pingInterval, err := parseOptionalDuration(cfg.PingInterval)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Hold > 0 {
+		if cfg.HTTP2 || cfg.Pipeline > 0 {
+			return nil, errors.New("holding connections requires HTTP/1.1 without pipelining")
+		}
+		if cfg.ConnNum <= 0 {
+			return nil, errors.New("holding connections requires at least one dialer")
+		}
+	}
+	workers := cfg.ConnNum * streams
+	if cfg.Pipeline > 0 {
+		workers = cfg.ConnNum * cfg.Pipeline
+	}
+	dialer := newDialer(connectTimeout, sources, resolve, cfg.SpreadDNS)
+	// requests of HTTP/2 and pipelined connections overlap, so their
+	// response phases can not be told apart
+	dialer.phases = !cfg.HTTP2 && cfg.Pipeline == 0
 	archer := &httpArcher{
-		target:   cfg.Target,
-		host:     u.Host,
-		interval: interval,
-		connNum:  cfg.ConnNum,
-		data:     cfg.Data,
-		num:      cfg.Num,
-		sighup:   cfg.Sighup,
-		printLog: cfg.PrintLog,
-		printErr: cfg.PrintError,
+		endpoints:      endpoints,
+		headers:        cfg.Headers,
+		headerTmpls:    headerTmpls,
+		interval:       interval,
+		duration:       duration,
+		requestTimeout: requestTimeout,
+		readTimeout:    readTimeout,
+		writeTimeout:   writeTimeout,
+		dialer:         dialer,
+		tlsConfig:      tlsConfig,
+		rate:           cfg.Rate,
+		profile:        p,
+		unit:           unit,
+		connNum:        cfg.ConnNum,
+		http2:          cfg.HTTP2,
+		streams:        streams,
+		pipeline:       cfg.Pipeline,
+		workers:        workers,
+		connRequests:   cfg.ConnRequests,
+		connLifetime:   connLifetime,
+		hold:           cfg.Hold,
+		holdRate:       cfg.HoldRate,
+		pingInterval:   pingInterval,
+		num:            cfg.Num,
+		records:        records,
+		successStatus:  successStatus,
+		assertions:     assertions,
+		assertSamples:  assertSamples{max: uint64(samples)},
+		sampleFile:     cfg.AssertSampleFile,
+		speed:          cfg.ReplaySpeed,
+		sighup:         cfg.Sighup,
+		printLog:       cfg.PrintLog,
+		printErr:       cfg.PrintError,
+		latency:        make([]*histogram, workers),
+	}
+	for i := range archer.latency {
+		archer.latency[i] = newHistogram()
 	}
-	if archer.printLog {
-		go archer.PrintStats(cfg.PrintLog)
+	if archer.scheduled() {
+		archer.lag = make([]*histogram, workers)
+		for i := range archer.lag {
+			archer.lag[i] = newHistogram()
+		}
 	}
-	return archer.Launch()
+	return archer, nil
+}
+
+// scheduled returns whether requests are sent at intended times, which is
+// in rate mode, rps load profile mode and timed replay
+func (h *httpArcher) scheduled() bool {
+	if h.records != nil {
+		return h.speed > 0
+	}
+	return h.rate > 0 || (h.unit == ProfileUnitRate && h.profile != nil)
+}
+
+// parseOptionalDuration parses s, empty s means 0
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Run launches the archer and prints final stats summary once it is finished
+func (h *httpArcher) Run(ctx context.Context) error {
+	if h.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.duration)
+		defer cancel()
+	}
+	h.started = time.Now()
+	if h.printLog {
+		go h.PrintStats(h.printLog)
+	}
+	launch := h.Launch
+	if h.hold > 0 {
+		launch = h.Hold
+	}
+	if err := launch(ctx); err != nil {
+		return err
+	}
+	h.PrintStatsOnce()
+	h.replayFailures.Print(h.records)
+	return h.assertSamples.Save(h.sampleFile)
 }
 
 func (h *httpArcher) PrintStats(periodic bool) {
@@ -156,6 +738,49 @@ func (h *httpArcher) PrintStats(periodic bool) {
 }
 
 func (h *httpArcher) PrintStatsOnce() {
-	log.Printf("Sent Bytes: %v, Received Bytes: %v, Succeeded: %v, Failed: %v",
-		h.SentBytes(), h.ReceivedBytes(), h.Succeeded(), h.Failed())
+	stats := h.stats.Load()
+	log.Printf("Sent Bytes: %v, Received Bytes: %v, Sent Payload: %v, Received Payload: %v, Succeeded: %v, Failed: %v",
+		h.SentBytes(), h.ReceivedBytes(), stats.sentPayload, stats.receivedPayload, stats.succeeded, stats.failed)
+	log.Printf("Status %s", formatStatus(&stats.status))
+	log.Printf("Errors %s", formatErrors(&stats.errors))
+	if len(h.assertions) > 0 {
+		log.Printf("Assertion Failed: %v", stats.assertFailed)
+	}
+	log.Printf("Latency %v", h.Latency())
+	if h.Lag().Count() > 0 {
+		log.Printf("Schedule Lag %v", h.Lag())
+	}
+	if h.hold > 0 {
+		log.Printf("Held Connections: %v, Opened: %v, Closed: %v", h.holdStats.Held(),
+			atomic.LoadUint64(&h.holdStats.opened), atomic.LoadUint64(&h.holdStats.closed))
+	}
+	if h.dialer.dns.Count() > 0 {
+		log.Printf("DNS Lookup %v", h.dialer.dns)
+	}
+	if n := h.dialer.connect.Count(); n > 0 {
+		log.Printf("Connections: %v, CPS: %.1f, Connect %v",
+			n, float64(n)/time.Since(h.started).Seconds(), h.dialer.connect)
+	}
+	if h.dialer.handshake.Count() > 0 {
+		log.Printf("TLS Handshake %v", h.dialer.handshake)
+	}
+	if h.dialer.ttfb.Count() > 0 {
+		log.Printf("TTFB %v", h.dialer.ttfb)
+	}
+	if h.dialer.transfer.Count() > 0 {
+		log.Printf("Transfer %v", h.dialer.transfer)
+	}
+	if len(h.endpoints) > 1 {
+		for _, e := range h.endpoints {
+			stats := e.stats.Load()
+			log.Printf("Endpoint %v Sent Payload: %v, Received Payload: %v, Succeeded: %v, Failed: %v",
+				e, stats.sentPayload, stats.receivedPayload, stats.succeeded, stats.failed)
+			log.Printf("Endpoint %v Status %s", e, formatStatus(&stats.status))
+			log.Printf("Endpoint %v Errors %s", e, formatErrors(&stats.errors))
+			if len(h.assertions) > 0 {
+				log.Printf("Endpoint %v Assertion Failed: %v", e, stats.assertFailed)
+			}
+			log.Printf("Endpoint %v Latency %v", e, e.latency)
+		}
+	}
 }
@@ -1,10 +1,25 @@
 package archer
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
 )
 
 func TestHTTPArcher(t *testing.T) {
@@ -25,7 +40,1183 @@ func TestHTTPArcher(t *testing.T) {
 
 	t.Logf("Archer launching at: %s\n", ts.URL)
 
-	if err := StartHTTPArcher(cfg); err != nil {
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+}
+
+func TestHTTPArcherRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:     ts.URL,
+		Interval:   "1ms",
+		Rate:       2000,
+		ConnNum:    10,
+		Data:       []byte{1, 2, 3},
+		PrintError: true,
+		Num:        1000,
+	}
+
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	start := time.Now()
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("rate not limited, 1000 requests finished in %v", d)
+	}
+	if n := archer.Lag().Count(); n != 1000 {
+		t.Errorf("schedule lag count incorrect: %d", n)
+	}
+
+	// lag is not tracked without schedule
+	cfg.Rate = 0
+	archer, err = newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if archer.lag != nil {
+		t.Errorf("schedule lag allocated without rate")
+	}
+}
+
+func TestHTTPArcherProfile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	for _, unit := range []string{ProfileUnitRate, ProfileUnitConn} {
+		cfg := Config{
+			Target:      ts.URL,
+			Interval:    "1ms",
+			Profile:     "steps:100,5,10:300ms",
+			ProfileUnit: unit,
+			ConnNum:     10,
+			Data:        []byte{1, 2, 3},
+			PrintError:  true,
+		}
+
+		start := time.Now()
+		if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+			t.Errorf("%s", err)
+		}
+		if d := time.Since(start); d < 900*time.Millisecond || d > 2*time.Second {
+			t.Errorf("profile unit %s, run time incorrect: %v", unit, d)
+		}
+	}
+
+	cfg := Config{Target: ts.URL, Profile: "steps:0,0:1s", ProfileUnit: ProfileUnitConn, Interval: "0s"}
+	if _, err := newHTTPArcher(cfg); err == nil {
+		t.Errorf("no error returned for load profile without load")
+	}
+}
+
+func TestHTTPArcherDuration(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:     ts.URL,
+		Interval:   "1ms",
+		Rate:       1000,
+		ConnNum:    10,
+		Data:       []byte{1, 2, 3},
+		PrintError: true,
+		Duration:   "500ms",
+	}
+
+	start := time.Now()
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if d := time.Since(start); d < 500*time.Millisecond || d > time.Second {
+		t.Errorf("run time incorrect: %v", d)
+	}
+
+	// cancel before duration is passed
+	cfg.Duration = "1m"
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := StartHTTPArcher(ctx, cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("run not cancelled: %v", d)
+	}
+}
+
+func TestHTTPArcherRequest(t *testing.T) {
+	var bad uint64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.Header.Get("Authorization") != "Bearer token" ||
+			r.URL.Query().Get("a") != "1" || r.URL.Query().Get("b") != "2" {
+			atomic.AddUint64(&bad, 1)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:     ts.URL + "/?a=1",
+		Method:     "get",
+		Headers:    []Header{{"Authorization", "Bearer token"}},
+		Query:      url.Values{"b": []string{"2"}},
+		Interval:   "1ms",
+		ConnNum:    2,
+		PrintError: true,
+		Num:        10,
+	}
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if atomic.LoadUint64(&bad) > 0 {
+		t.Errorf("%d requests incorrect", bad)
+	}
+
+	cfg.Data = []byte{1, 2, 3}
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for GET request with body")
+	}
+}
+
+func TestHTTPArcherHeaders(t *testing.T) {
+	var bad uint64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reflect.DeepEqual(r.Header["Content-Type"], []string{"application/json"}) ||
+			!reflect.DeepEqual(r.Header["User-Agent"], []string{"stress-test"}) ||
+			!reflect.DeepEqual(r.Header["Accept"], []string{"text/plain", "application/json"}) {
+			atomic.AddUint64(&bad, 1)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target: ts.URL,
+		Method: "POST",
+		Data:   []byte("{}"),
+		Headers: []Header{
+			{"Content-Type", "application/json"},
+			{"User-Agent", "stress-test"},
+			{"Accept", "text/plain"},
+			{"Accept", "application/json"},
+		},
+		Interval:   "0s",
+		ConnNum:    1,
+		PrintError: true,
+		Num:        10,
+	}
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if atomic.LoadUint64(&bad) > 0 {
+		t.Errorf("%d requests have default headers not replaced", bad)
+	}
+}
+
+func TestHTTPArcherEndpoints(t *testing.T) {
+	var gets, posts uint64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/get":
+			atomic.AddUint64(&gets, 1)
+		case r.Method == "POST" && r.URL.Path == "/post":
+			atomic.AddUint64(&posts, 1)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Endpoints: []Endpoint{
+			{URL: ts.URL + "/get", Method: "GET", Weight: 3},
+			{URL: ts.URL + "/post", Method: "POST", Body: "stress", Weight: 1},
+		},
+		Interval:   "0s",
+		ConnNum:    4,
+		PrintError: true,
+		Num:        2000,
+	}
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if gets+posts != 2000 || gets < 1300 || gets > 1700 {
+		t.Errorf("requests not distributed by weight, GET: %d, POST: %d", gets, posts)
+	}
+}
+
+func TestHTTPArcherTemplate(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		bad  uint64
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		id := r.URL.Query().Get("id")
+		if string(body) != "seq="+id || r.Header.Get("X-Request-Id") != id {
+			atomic.AddUint64(&bad, 1)
+		}
+		mu.Lock()
+		seen[id] = true
+		mu.Unlock()
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Endpoints: []Endpoint{
+			{URL: ts.URL + "/items/{{worker}}?id={{seq}}", Method: "POST", Body: "seq={{seq}}"},
+		},
+		Headers:    []Header{{"X-Request-Id", "{{seq}}"}},
+		Interval:   "0s",
+		ConnNum:    1,
+		PrintError: true,
+		Num:        100,
+	}
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if n := atomic.LoadUint64(&bad); n > 0 {
+		t.Errorf("%d requests have inconsistent sequence", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 100 {
+		t.Errorf("url template not evaluated per request, %d distinct ids", len(seen))
+	}
+}
+
+func TestHTTPArcherReplay(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Test")+" "+r.Header.Get("X-Extra"))
+		mu.Unlock()
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Replay: []Record{
+			{Method: "GET", URL: ts.URL + "/a", Headers: Headers{{"X-Test", "a"}, {"X-Extra", "a"}}, Offset: 0},
+			{Method: "POST", URL: ts.URL + "/b", Body: "b", Offset: 200},
+			{Method: "GET", URL: "http://127.0.0.1:1/unreachable", Offset: 400},
+			{Method: "DELETE", URL: ts.URL + "/c", Offset: 600},
+		},
+		ReplaySpeed: 2,
+		Headers:     []Header{{"X-Extra", "h"}},
+		Interval:    "0s",
+		ConnNum:     2,
+	}
+	start := time.Now()
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("records not replayed at captured timing: %v", d)
+	}
+	expect := []string{"GET /a a h", "POST /b  h", "DELETE /c  h"}
+	mu.Lock()
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("replayed requests incorrect: %v", paths)
+	}
+	mu.Unlock()
+
+	cfg.Headers = []Header{{"X-Request-Id", "{{seq}}"}}
+	if _, err := newHTTPArcher(cfg); err == nil {
+		t.Errorf("no error returned for header templates in replay")
+	}
+}
+
+func TestHTTPArcherStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Endpoints: []Endpoint{
+			{URL: ts.URL + "/ok", Method: "GET"},
+			{URL: ts.URL + "/busy", Method: "GET"},
+			{URL: ts.URL + "/error", Method: "GET"},
+		},
+		SuccessStatus: "2xx,429",
+		Interval:      "0s",
+		ConnNum:       2,
+		Num:           300,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	stats := archer.stats.Load()
+	if stats.status[200]+stats.status[429]+stats.status[500] != 300 {
+		t.Errorf("status count incorrect: %s", formatStatus(&stats.status))
+	}
+	if stats.succeeded != stats.status[200]+stats.status[429] || stats.failed != stats.status[500] {
+		t.Errorf("succeeded/failed incorrect: %v/%v, status: %s",
+			stats.succeeded, stats.failed, formatStatus(&stats.status))
+	}
+	for _, e := range archer.endpoints {
+		if e.stats.Load().succeeded+e.stats.Load().failed == 0 {
+			t.Errorf("endpoint %v has no request", e)
+		}
+	}
+
+	cfg.SuccessStatus = "abc"
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for invalid success status")
+	}
+}
+
+func TestHTTPArcherAssertion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			fmt.Fprint(w, `{"code": 1}`)
+			return
+		}
+		w.Header().Set("X-Request-Id", "1")
+		fmt.Fprint(w, `{"code": 0}`)
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Endpoints: []Endpoint{
+			{URL: ts.URL + "/good", Method: "GET"},
+			{URL: ts.URL + "/bad", Method: "GET"},
+		},
+		Assertions:    []string{"json:code=0", "header:X-Request-Id", "size:1-100"},
+		AssertSamples: 3,
+		Interval:      "0s",
+		ConnNum:       2,
+		Num:           200,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
 		t.Errorf("%s", err)
 	}
+	stats := archer.stats.Load()
+	good := archer.endpoints[0].stats.Load()
+	bad := archer.endpoints[1].stats.Load()
+	if good.assertFailed != 0 || good.failed != 0 {
+		t.Errorf("good endpoint failed: %v/%v", good.failed, good.assertFailed)
+	}
+	if bad.assertFailed == 0 || bad.assertFailed != bad.failed || bad.succeeded != 0 {
+		t.Errorf("bad endpoint not failed: %v/%v", bad.failed, bad.assertFailed)
+	}
+	if stats.assertFailed != bad.assertFailed || stats.status[200] != 200 {
+		t.Errorf("stats incorrect: %v, status: %s", stats.assertFailed, formatStatus(&stats.status))
+	}
+	if len(archer.assertSamples.samples) != 3 {
+		t.Errorf("sample number incorrect: %d", len(archer.assertSamples.samples))
+	}
+
+	cfg.Assertions = []string{"regex:("}
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for invalid assertion")
+	}
+}
+
+func TestHTTPArcherCancel(t *testing.T) {
+	stuck := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stuck
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	ts2 := httptest.NewUnstartedServer(handler)
+	ts2.EnableHTTP2 = true
+	ts2.StartTLS()
+	defer ts2.Close()
+	// handlers return before servers are closed
+	defer close(stuck)
+
+	for _, h2 := range []bool{false, true} {
+		cfg := Config{
+			Target:   ts.URL,
+			Method:   "GET",
+			Interval: "0s",
+			ConnNum:  2,
+		}
+		if h2 {
+			cfg.Target = ts2.URL
+			cfg.HTTP2 = true
+			cfg.TLS.InsecureSkipVerify = true
+		}
+		archer, err := newHTTPArcher(cfg)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		if err := archer.Run(ctx); err != nil {
+			t.Errorf("%s", err)
+		}
+		cancel()
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("HTTP/2 %v: requests in flight not interrupted, stopped after %v", h2, d)
+		}
+		if archer.Succeeded() > 0 || archer.Failed() > 0 {
+			t.Errorf("HTTP/2 %v: interrupted requests counted, succeeded: %d, failed: %d",
+				h2, archer.Succeeded(), archer.Failed())
+		}
+	}
+}
+
+func TestHTTPArcherTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-done:
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	var tests = []struct {
+		request string
+		read    string
+	}{
+		{"20ms", ""},
+		{"", "20ms"},
+	}
+	for caseid, c := range tests {
+		cfg := Config{
+			Target:         ts.URL,
+			Method:         "POST",
+			RequestTimeout: c.request,
+			ReadTimeout:    c.read,
+			Interval:       "0s",
+			ConnNum:        2,
+			Num:            2,
+		}
+		archer, err := newHTTPArcher(cfg)
+		if err != nil {
+			t.Fatalf("case #%d, %s", caseid+1, err)
+		}
+		if err := archer.Run(context.Background()); err != nil {
+			t.Errorf("case #%d, %s", caseid+1, err)
+		}
+		stats := archer.stats.Load()
+		if stats.errors[errTimeout] != 2 || stats.failed != 2 {
+			t.Errorf("case #%d, timeouts incorrect: %v/%v", caseid+1, stats.errors[errTimeout], stats.failed)
+		}
+		if n := archer.Latency().Count(); n != 0 {
+			t.Errorf("case #%d, timeouts counted in latency: %d", caseid+1, n)
+		}
+	}
+
+	cfg := Config{Target: ts.URL, Interval: "0s", ConnectTimeout: "abc"}
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for invalid timeout")
+	}
+}
+
+func TestHTTPArcherTimeoutBody(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		first  = make(chan struct{}, 1)
+	)
+	first <- struct{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		select {
+		case <-first:
+			// only the first request times out
+			time.Sleep(300 * time.Millisecond)
+		default:
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:         ts.URL,
+		Method:         "PUT",
+		Data:           []byte("hello"),
+		RequestTimeout: "100ms",
+		Interval:       "0s",
+		ConnNum:        1,
+		Num:            6,
+	}
+	if err := StartHTTPArcher(context.Background(), cfg); err != nil {
+		t.Errorf("%s", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) < 2 {
+		t.Fatalf("no request sent after timeout: %v", bodies)
+	}
+	for i, b := range bodies {
+		if b != "hello" {
+			t.Errorf("request #%d body incorrect: %q", i+1, b)
+		}
+	}
+}
+
+func TestHTTPArcherTimeoutConns(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	cfg := Config{
+		Target:         ts.URL,
+		Method:         "GET",
+		RequestTimeout: "100ms",
+		Interval:       "0s",
+		ConnNum:        2,
+		Duration:       "1s",
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	// requests wait for connections held by timed out requests
+	stats := archer.stats.Load()
+	if stats.errors[errTooManyConns] > 0 || stats.failed > 30 || stats.errors[errTimeout] != stats.failed {
+		t.Errorf("errors of hung target incorrect: %s", formatErrors(&stats.errors))
+	}
+}
+
+func TestHTTPArcherErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	// connections to closed server are refused
+	target := ts.URL
+	ts.Close()
+
+	cfg := Config{
+		Target:   target,
+		Interval: "0s",
+		ConnNum:  2,
+		Num:      10,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	stats := archer.stats.Load()
+	if stats.errors[errRefused] != 10 || stats.failed != 10 {
+		t.Errorf("errors incorrect: %s", formatErrors(&stats.errors))
+	}
+	if n := archer.Latency().Count(); n != 0 {
+		t.Errorf("errors counted in latency: %d", n)
+	}
+}
+
+func TestHTTPArcherTLS(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+	ts := httptest.NewTLSServer(handler)
+	defer ts.Close()
+	// server requiring client certificate, TLS 1.2 rejects missing
+	// certificate in handshake instead of the first read
+	mts := httptest.NewUnstartedServer(handler)
+	mts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MaxVersion: tls.VersionTLS12}
+	mts.StartTLS()
+	defer mts.Close()
+
+	// test server certificate is used as CA and client certificate
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	cert := ts.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var tests = []struct {
+		target string
+		tls    TLSConfig
+		ok     bool
+	}{
+		{ts.URL, TLSConfig{CAFile: certFile}, true},
+		{ts.URL, TLSConfig{}, false},
+		{ts.URL, TLSConfig{InsecureSkipVerify: true, MinVersion: "1.2"}, true},
+		{ts.URL, TLSConfig{CAFile: certFile, ServerName: "example.com"}, true},
+		{ts.URL, TLSConfig{CAFile: certFile, ServerName: "stress.invalid"}, false},
+		{mts.URL, TLSConfig{InsecureSkipVerify: true}, false},
+		{mts.URL, TLSConfig{InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile}, true},
+	}
+	for caseid, c := range tests {
+		cfg := Config{
+			Target:   c.target,
+			Method:   "GET",
+			TLS:      c.tls,
+			Interval: "0s",
+			ConnNum:  2,
+			Num:      10,
+		}
+		archer, err := newHTTPArcher(cfg)
+		if err != nil {
+			t.Fatalf("case #%d, %s", caseid+1, err)
+		}
+		if err := archer.Run(context.Background()); err != nil {
+			t.Errorf("case #%d, %s", caseid+1, err)
+		}
+		stats := archer.stats.Load()
+		if c.ok && (stats.succeeded != 10 || archer.dialer.handshake.Count() == 0) {
+			t.Errorf("case #%d, request failed: %s", caseid+1, formatErrors(&stats.errors))
+		}
+		if !c.ok && stats.errors[errTLS] != 10 {
+			t.Errorf("case #%d, tls errors incorrect: %s", caseid+1, formatErrors(&stats.errors))
+		}
+	}
+}
+
+func TestHTTPArcherHTTP2(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns = make(map[string]bool)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		ioutil.ReadAll(r.Body)
+		fmt.Fprintln(w, "Hello, client")
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	// h2c server with prior knowledge
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+
+	var tests = []string{ts.URL, "http://" + ln.Addr().String()}
+	for caseid, target := range tests {
+		mu.Lock()
+		conns = make(map[string]bool)
+		mu.Unlock()
+		cfg := Config{
+			Target:   target,
+			Method:   "POST",
+			Data:     []byte("hello"),
+			TLS:      TLSConfig{InsecureSkipVerify: true},
+			HTTP2:    true,
+			Streams:  4,
+			Interval: "0s",
+			ConnNum:  2,
+			Num:      40,
+		}
+		archer, err := newHTTPArcher(cfg)
+		if err != nil {
+			t.Fatalf("case #%d, %s", caseid+1, err)
+		}
+		if err := archer.Run(context.Background()); err != nil {
+			t.Errorf("case #%d, %s", caseid+1, err)
+		}
+		stats := archer.stats.Load()
+		if stats.status[200] != 40 {
+			t.Errorf("case #%d, status incorrect: %s, errors: %s",
+				caseid+1, formatStatus(&stats.status), formatErrors(&stats.errors))
+		}
+		if stats.receivedPayload == 0 {
+			t.Errorf("case #%d, no received bytes", caseid+1)
+		}
+		mu.Lock()
+		if len(conns) != 2 {
+			t.Errorf("case #%d, connection number incorrect: %d", caseid+1, len(conns))
+		}
+		mu.Unlock()
+	}
+
+	cfg := Config{Target: ts.URL, Interval: "0s", Streams: 2}
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for streams without HTTP/2")
+	}
+}
+
+func TestHTTPArcherHTTP2StreamLimit(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns = make(map[string]bool)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprintln(w, "Hello, client")
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer ln.Close()
+	srv := &http2.Server{MaxConcurrentStreams: 10}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+
+	// streams of the connection are more than the server allows
+	cfg := Config{
+		Target:   "http://" + ln.Addr().String(),
+		HTTP2:    true,
+		Streams:  10,
+		Interval: "0s",
+		ConnNum:  1,
+		Num:      200,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	stats := archer.stats.Load()
+	if stats.status[200] != 200 {
+		t.Errorf("status incorrect: %s, errors: %s",
+			formatStatus(&stats.status), formatErrors(&stats.errors))
+	}
+	mu.Lock()
+	if len(conns) != 1 {
+		t.Errorf("connection number incorrect: %d", len(conns))
+	}
+	mu.Unlock()
+}
+
+func TestHTTPArcherPipeline(t *testing.T) {
+	var (
+		conns   int32
+		badBody uint64
+	)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := ioutil.ReadAll(r.Body); r.Method == "POST" && string(body) != "hello" {
+			atomic.AddUint64(&badBody, 1)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	cfg := Config{
+		Target:   ts.URL,
+		Method:   "GET",
+		Pipeline: 4,
+		Interval: "0s",
+		ConnNum:  2,
+		Num:      80,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if archer.workers != 8 {
+		t.Errorf("worker number incorrect: %d", archer.workers)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	stats := archer.stats.Load()
+	if stats.status[200] != 80 {
+		t.Errorf("status incorrect: %s, errors: %s", formatStatus(&stats.status), formatErrors(&stats.errors))
+	}
+	if n := atomic.LoadInt32(&conns); n == 0 || n > 2 {
+		t.Errorf("connection number incorrect: %d", n)
+	}
+
+	// requests with timeout are sent as copies, body is kept for later ones
+	body := cfg
+	body.Method = "POST"
+	body.Data = []byte("hello")
+	body.Pipeline = 1
+	body.RequestTimeout = "1s"
+	if err := StartHTTPArcher(context.Background(), body); err != nil {
+		t.Errorf("%s", err)
+	}
+	if n := atomic.LoadUint64(&badBody); n > 0 {
+		t.Errorf("%d pipelined requests with timeout lost body", n)
+	}
+
+	cfg.HTTP2 = true
+	if err := StartHTTPArcher(context.Background(), cfg); err == nil {
+		t.Errorf("no error returned for pipelining over HTTP/2")
+	}
+}
+
+func TestHTTPArcherChurn(t *testing.T) {
+	var tests = []struct {
+		caseid   int
+		cfg      Config
+		min, max int32
+	}{
+		{
+			caseid: 1,
+			cfg:    Config{ConnRequests: 1, ConnNum: 2, Num: 20, Interval: "0s"},
+			min:    20,
+			max:    20,
+		},
+		{
+			caseid: 2,
+			cfg:    Config{ConnRequests: 5, ConnNum: 1, Num: 20, Interval: "0s"},
+			min:    4,
+			max:    4,
+		},
+		{
+			caseid: 3,
+			cfg:    Config{ConnLifetime: "50ms", ConnNum: 1, Num: 10, Interval: "20ms"},
+			min:    2,
+			max:    9,
+		},
+	}
+	for _, tt := range tests {
+		var conns int32
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "Hello, client")
+		}))
+		ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+			if s == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		ts.Start()
+
+		tt.cfg.Target = ts.URL
+		tt.cfg.Method = "GET"
+		archer, err := newHTTPArcher(tt.cfg)
+		if err != nil {
+			t.Fatalf("case #%d: %s", tt.caseid, err)
+		}
+		if err := archer.Run(context.Background()); err != nil {
+			t.Errorf("case #%d: %s", tt.caseid, err)
+		}
+		ts.Close()
+		stats := archer.stats.Load()
+		if stats.status[200] != tt.cfg.Num {
+			t.Errorf("case #%d: status incorrect: %s, errors: %s",
+				tt.caseid, formatStatus(&stats.status), formatErrors(&stats.errors))
+		}
+		n := atomic.LoadInt32(&conns)
+		if n < tt.min || n > tt.max {
+			t.Errorf("case #%d: connection number incorrect: %d", tt.caseid, n)
+		}
+		if c := archer.dialer.connect.Count(); c != uint64(n) {
+			t.Errorf("case #%d: connect count incorrect: %d, expecting %d", tt.caseid, c, n)
+		}
+	}
+
+	cfg := Config{Target: "http://127.0.0.1", ConnRequests: 1, ConnNum: 1, HTTP2: true, Interval: "0s"}
+	if _, err := newHTTPArcher(cfg); err == nil {
+		t.Errorf("no error returned for connection churn over HTTP/2")
+	}
+}
+
+func TestHTTPArcherHold(t *testing.T) {
+	var tests = []struct {
+		caseid int
+		cfg    Config
+		// server read timeout, it closes idle connections
+		readTimeout     time.Duration
+		minOpened       uint64
+		maxOpened       uint64
+		closed          uint64
+		expectSucceeded bool
+	}{
+		{
+			caseid:    1,
+			cfg:       Config{Hold: 20, ConnNum: 4, Duration: "300ms"},
+			minOpened: 20,
+			maxOpened: 20,
+		},
+		{
+			caseid:          2,
+			cfg:             Config{Hold: 10, ConnNum: 2, Method: "POST", Data: []byte("ping"), PingInterval: "50ms", Duration: "300ms"},
+			minOpened:       10,
+			maxOpened:       10,
+			expectSucceeded: true,
+		},
+		{
+			caseid:    3,
+			cfg:       Config{Hold: 100, HoldRate: 50, ConnNum: 2, Duration: "300ms"},
+			minOpened: 5,
+			maxOpened: 20,
+		},
+		{
+			caseid:      4,
+			cfg:         Config{Hold: 5, ConnNum: 1, Duration: "300ms"},
+			readTimeout: 50 * time.Millisecond,
+			minOpened:   5,
+			maxOpened:   5,
+			closed:      5,
+		},
+	}
+	for _, tt := range tests {
+		var conns int32
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "Hello, client")
+		}))
+		ts.Config.ReadTimeout = tt.readTimeout
+		ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+			if s == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		ts.Start()
+
+		tt.cfg.Target = ts.URL
+		if len(tt.cfg.Method) == 0 {
+			tt.cfg.Method = "GET"
+		}
+		tt.cfg.Interval = "0s"
+		archer, err := newHTTPArcher(tt.cfg)
+		if err != nil {
+			t.Fatalf("case #%d: %s", tt.caseid, err)
+		}
+		if err := archer.Run(context.Background()); err != nil {
+			t.Errorf("case #%d: %s", tt.caseid, err)
+		}
+		ts.Close()
+		opened := atomic.LoadUint64(&archer.holdStats.opened)
+		if opened < tt.minOpened || opened > tt.maxOpened || uint64(atomic.LoadInt32(&conns)) != opened {
+			t.Errorf("case #%d: opened connections incorrect: %d, server accepted: %d",
+				tt.caseid, opened, atomic.LoadInt32(&conns))
+		}
+		if closed := atomic.LoadUint64(&archer.holdStats.closed); closed != tt.closed {
+			t.Errorf("case #%d: closed connections incorrect: %d", tt.caseid, closed)
+		}
+		if (archer.Succeeded() > 0) != tt.expectSucceeded || archer.Failed() > 0 {
+			t.Errorf("case #%d: ping stats incorrect, succeeded: %d, failed: %d",
+				tt.caseid, archer.Succeeded(), archer.Failed())
+		}
+		pings := archer.Succeeded()
+		if archer.SentPayload() != pings*uint64(len(tt.cfg.Data)) ||
+			archer.ReceivedPayload() != pings*uint64(len("Hello, client\n")) {
+			t.Errorf("case #%d: ping payload incorrect, sent: %d, received: %d",
+				tt.caseid, archer.SentPayload(), archer.ReceivedPayload())
+		}
+	}
+
+	cfg := Config{Target: "http://127.0.0.1", Hold: 10, ConnNum: 1, HTTP2: true, Interval: "0s"}
+	if _, err := newHTTPArcher(cfg); err == nil {
+		t.Errorf("no error returned for holding HTTP/2 connections")
+	}
+}
+
+func TestHTTPArcherSources(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		sources = make(map[string]int)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		sources[host]++
+		mu.Unlock()
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:       ts.URL,
+		Method:       "GET",
+		Sources:      []string{"127.0.0.1", "127.0.0.2"},
+		ConnRequests: 1,
+		Interval:     "0s",
+		ConnNum:      1,
+		Num:          4,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	if sources["127.0.0.1"] != 2 || sources["127.0.0.2"] != 2 {
+		t.Errorf("requests of source addresses incorrect: %v", sources)
+	}
+
+	cfg.Sources = []string{"127.0.0.1:80"}
+	if _, err := newHTTPArcher(cfg); err == nil {
+		t.Errorf("no error returned for invalid source address")
+	}
+}
+
+func TestHTTPArcherPhases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintln(w, "Hello,")
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond)
+		fmt.Fprintln(w, "client")
+	}))
+	defer ts.Close()
+
+	cfg := Config{
+		Target:       ts.URL,
+		Method:       "GET",
+		ConnRequests: 2,
+		Interval:     "0s",
+		ConnNum:      1,
+		Num:          4,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	d := archer.dialer
+	if d.ttfb.Count() != 4 || d.ttfb.Min() < 50*time.Millisecond {
+		t.Errorf("TTFB incorrect: %v", d.ttfb)
+	}
+	if d.transfer.Count() != 4 || d.transfer.Min() < 30*time.Millisecond || d.transfer.Max() > d.ttfb.Min() {
+		t.Errorf("transfer incorrect: %v", d.transfer)
+	}
+}
+
+// countListener counts bytes read from and written to accepted connections
+type countListener struct {
+	net.Listener
+	read, written uint64
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countConn{Conn: c, l: l}, nil
+}
+
+type countConn struct {
+	net.Conn
+	l *countListener
+}
+
+func (c *countConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.l.read, uint64(n))
+	return n, err
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.l.written, uint64(n))
+	return n, err
+}
+
+func TestHTTPArcherWireBytes(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// chunked response
+		fmt.Fprint(w, "Hello, ")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, "client")
+	}))
+	ln := &countListener{Listener: ts.Listener}
+	ts.Listener = ln
+	ts.Start()
+
+	cfg := Config{
+		Target:   ts.URL,
+		Method:   "POST",
+		Data:     []byte("hello"),
+		Interval: "0s",
+		ConnNum:  2,
+		Num:      10,
+	}
+	archer, err := newHTTPArcher(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := archer.Run(context.Background()); err != nil {
+		t.Errorf("%s", err)
+	}
+	ts.Close()
+	if archer.SentPayload() != 50 || archer.ReceivedPayload() != 130 {
+		t.Errorf("payload incorrect, sent: %d, received: %d", archer.SentPayload(), archer.ReceivedPayload())
+	}
+	if archer.SentBytes() != atomic.LoadUint64(&ln.read) || archer.ReceivedBytes() != atomic.LoadUint64(&ln.written) {
+		t.Errorf("wire bytes incorrect, sent: %d, received: %d, expecting %d, %d",
+			archer.SentBytes(), archer.ReceivedBytes(), atomic.LoadUint64(&ln.read), atomic.LoadUint64(&ln.written))
+	}
+	if archer.ReceivedBytes() <= archer.ReceivedPayload() {
+		t.Errorf("wire bytes not larger than payload: %d", archer.ReceivedBytes())
+	}
 }
@@ -0,0 +1,57 @@
+package archer
+
+import (
+	"net"
+	"time"
+)
+
+// phaseConn measures response phases of requests sent one at a time on
+// a connection: time to first byte is from the last write of a request
+// to the first read of its response, transfer is from the first read to
+// the last one before next request is written or the connection is
+// closed. It does not apply to pipelined or multiplexed connections.
+type phaseConn struct {
+	net.Conn
+	d *dialer
+	// if response of last request is being read
+	reading   bool
+	lastWrite time.Time
+	firstRead time.Time
+	lastRead  time.Time
+}
+
+func (c *phaseConn) Write(b []byte) (int, error) {
+	if c.reading {
+		c.finish()
+	}
+	n, err := c.Conn.Write(b)
+	c.lastWrite = time.Now()
+	return n, err
+}
+
+func (c *phaseConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		now := time.Now()
+		if !c.reading && !c.lastWrite.IsZero() {
+			c.reading = true
+			c.firstRead = now
+			c.d.ttfb.Record(now.Sub(c.lastWrite))
+		}
+		c.lastRead = now
+	}
+	return n, err
+}
+
+func (c *phaseConn) Close() error {
+	if c.reading {
+		c.finish()
+	}
+	return c.Conn.Close()
+}
+
+// finish records transfer time of the response read
+func (c *phaseConn) finish() {
+	c.reading = false
+	c.d.transfer.Record(c.lastRead.Sub(c.firstRead))
+}
@@ -0,0 +1,186 @@
+package archer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ProfileUnitRate makes profile levels requests per second
+	ProfileUnitRate = "rps"
+	// ProfileUnitConn makes profile levels active connection number
+	ProfileUnitConn = "conn"
+)
+
+// forever is the duration of stage used by constant rate mode
+const forever = time.Duration(math.MaxInt64)
+
+// Stage is one stage of load profile, load level changes linearly
+// from From to To during Duration.
+type Stage struct {
+	From     uint64
+	To       uint64
+	Duration time.Duration
+}
+
+// Level returns the load level at elapsed time d since stage start
+func (s Stage) Level(d time.Duration) float64 {
+	if s.From == s.To || s.Duration <= 0 {
+		return float64(s.To)
+	}
+	r := float64(d) / float64(s.Duration)
+	return float64(s.From) + (float64(s.To)-float64(s.From))*r
+}
+
+func (s Stage) String() string {
+	if s.From == s.To {
+		return fmt.Sprintf("%d for %v", s.To, s.Duration)
+	}
+	return fmt.Sprintf("%d-%d for %v", s.From, s.To, s.Duration)
+}
+
+// profile is a sequence of stages run one after another
+type profile []Stage
+
+// At returns the stage index and load level at elapsed time d since profile
+// start, index is len(p) once all stages are finished.
+func (p profile) At(d time.Duration) (int, float64) {
+	for i, s := range p {
+		if d < s.Duration {
+			return i, s.Level(d)
+		}
+		d -= s.Duration
+	}
+	return len(p), 0
+}
+
+// End returns the elapsed time since profile start when stage i is
+// finished, it is forever if that is beyond the longest duration.
+func (p profile) End(i int) time.Duration {
+	var end time.Duration
+	for _, s := range p[:i+1] {
+		if s.Duration > forever-end {
+			return forever
+		}
+		end += s.Duration
+	}
+	return end
+}
+
+// Max returns the highest load level of all stages
+func (p profile) Max() uint64 {
+	var max uint64
+	for _, s := range p {
+		if s.From > max {
+			max = s.From
+		}
+		if s.To > max {
+			max = s.To
+		}
+	}
+	return max
+}
+
+// parseProfile parses load profile string, supported formats are:
+//
+//	ramp:FROM-TO:DURATION         e.g. ramp:100-1000:30s
+//	steps:LEVEL,LEVEL,...:HOLD    e.g. steps:100,200,400:10s
+//	spike:BASE-PEAK:HOLD:SPIKE    e.g. spike:100-2000:30s:5s
+//	stages:FROM[-TO]:DURATION,... e.g. stages:0-500:10s,500:1m
+func parseProfile(raw string) (profile, error) {
+	kind, args := raw, ""
+	if i := strings.Index(raw, ":"); i >= 0 {
+		kind, args = raw[:i], raw[i+1:]
+	}
+	fields := strings.Split(args, ":")
+	switch kind {
+	case "ramp":
+		if len(fields) != 2 {
+			break
+		}
+		return parseStages(args)
+	case "steps":
+		if len(fields) != 2 {
+			break
+		}
+		var p profile
+		hold, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range strings.Split(fields[0], ",") {
+			level, err := strconv.ParseUint(l, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, Stage{From: level, To: level, Duration: hold})
+		}
+		return p, nil
+	case "spike":
+		if len(fields) != 3 {
+			break
+		}
+		base, peak, err := parseLevels(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		hold, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		spike, err := time.ParseDuration(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		return profile{
+			{From: base, To: base, Duration: hold},
+			{From: peak, To: peak, Duration: spike},
+			{From: base, To: base, Duration: hold},
+		}, nil
+	case "stages":
+		return parseStages(args)
+	}
+	return nil, errors.New("invalid load profile: " + raw)
+}
+
+// parseStages parses comma separated FROM[-TO]:DURATION stages
+func parseStages(raw string) (profile, error) {
+	var p profile
+	for _, s := range strings.Split(raw, ",") {
+		fields := strings.Split(s, ":")
+		if len(fields) != 2 {
+			return nil, errors.New("invalid load profile stage: " + s)
+		}
+		from, to, err := parseLevels(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, Stage{From: from, To: to, Duration: d})
+	}
+	return p, nil
+}
+
+// parseLevels parses FROM[-TO] load levels
+func parseLevels(raw string) (uint64, uint64, error) {
+	levels := strings.SplitN(raw, "-", 2)
+	from, err := strconv.ParseUint(levels[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(levels) == 1 {
+		return from, from, nil
+	}
+	to, err := strconv.ParseUint(levels[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
@@ -0,0 +1,101 @@
+package archer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProfile(t *testing.T) {
+	var tests = []struct {
+		s   string
+		e   profile
+		err bool
+	}{
+		{
+			"ramp:100-1000:30s",
+			profile{{100, 1000, 30 * time.Second}},
+			false,
+		},
+		{
+			"steps:100,200,400:10s",
+			profile{
+				{100, 100, 10 * time.Second},
+				{200, 200, 10 * time.Second},
+				{400, 400, 10 * time.Second},
+			},
+			false,
+		},
+		{
+			"spike:100-2000:30s:5s",
+			profile{
+				{100, 100, 30 * time.Second},
+				{2000, 2000, 5 * time.Second},
+				{100, 100, 30 * time.Second},
+			},
+			false,
+		},
+		{
+			"stages:0-500:10s,500:1m",
+			profile{{0, 500, 10 * time.Second}, {500, 500, time.Minute}},
+			false,
+		},
+		{
+			"ramp:100-1000",
+			nil,
+			true,
+		},
+		{
+			"steps:a,b:10s",
+			nil,
+			true,
+		},
+		{
+			"unknown:1:1s",
+			nil,
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		res, err := parseProfile(c.s)
+		if err != nil {
+			if c.err {
+				t.Logf("case #%d, err: %v", caseid+1, err)
+			} else {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+		}
+		if !reflect.DeepEqual(res, c.e) {
+			t.Errorf("case #%d, result incorrect: %v", caseid+1, res)
+		}
+	}
+}
+
+func TestProfileAt(t *testing.T) {
+	p := profile{{0, 100, 10 * time.Second}, {100, 100, 10 * time.Second}}
+	var tests = []struct {
+		d     time.Duration
+		stage int
+		level float64
+	}{
+		{0, 0, 0},
+		{5 * time.Second, 0, 50},
+		{10 * time.Second, 1, 100},
+		{15 * time.Second, 1, 100},
+		{20 * time.Second, 2, 0},
+	}
+	for caseid, c := range tests {
+		stage, level := p.At(c.d)
+		if stage != c.stage || level != c.level {
+			t.Errorf("case #%d, result incorrect: %d %v", caseid+1, stage, level)
+		}
+	}
+	if p.Max() != 100 {
+		t.Errorf("max incorrect: %v", p.Max())
+	}
+}
@@ -0,0 +1,104 @@
+package archer
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ticket tells a worker to send a request
+type ticket struct {
+	// intended send time, zero if request is not scheduled
+	intended time.Time
+	// index of replay record, -1 for requests to endpoints
+	record int
+}
+
+// idleCheckInterval is how often the load level is checked again
+// while the profile asks for no load at all, and the longest step the
+// request rate is integrated over
+const idleCheckInterval = 10 * time.Millisecond
+
+// schedule emits the intended send time of each request on a global clock
+// following the request rate of profile p, independent of response times.
+// Requests are accumulated by integrating the rate over time, so rates
+// below 1 rps and ramps starting from 0 send requests as well, and steps
+// never cross stage boundaries where the rate may change abruptly.
+// If workers can not keep up, sending to tickets blocks and the generator
+// falls behind schedule, which is reflected in the schedule lag of requests.
+// schedule closes tickets when the profile is finished and returns when
+// ctx is done.
+func schedule(ctx context.Context, p profile, start time.Time, tickets chan<- ticket) {
+	var (
+		intended = start
+		// requests accumulated but not sent yet
+		credit  float64
+		elapsed time.Duration
+	)
+	stage, rate := p.At(0)
+	if rate > 0 {
+		// the first request is sent right away
+		credit = 1
+	}
+	for stage < len(p) {
+		// tolerate rounding errors of accumulated fractions
+		if credit >= 1-1e-9 {
+			if !sleep(ctx, intended.Sub(time.Now())) {
+				return
+			}
+			select {
+			case tickets <- ticket{intended: intended, record: -1}:
+			case <-ctx.Done():
+				return
+			}
+			credit--
+			continue
+		}
+		step := idleCheckInterval
+		if rate > 0 {
+			if d := time.Duration(math.Ceil((1 - credit) / rate * float64(time.Second))); d < step {
+				step = d
+			}
+		}
+		if end := p.End(stage); end-elapsed < step {
+			step = end - elapsed
+		}
+		if step <= 0 {
+			step = 1
+		}
+		elapsed += step
+		intended = intended.Add(step)
+		// rate is linear in a stage, the step ends at the stage end at most
+		end := p[stage].Level(p[stage].Duration)
+		next, nextRate := p.At(elapsed)
+		if next == stage {
+			end = nextRate
+		}
+		credit += (rate + end) / 2 * step.Seconds()
+		stage, rate = next, nextRate
+	}
+	if sleep(ctx, intended.Sub(time.Now())) {
+		close(tickets)
+	}
+}
+
+// sleep pauses for duration d, it returns false if ctx is done before that
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+			return true
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
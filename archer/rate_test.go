@@ -0,0 +1,44 @@
+package archer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestSchedule(t *testing.T) {
+	var tests = []struct {
+		p profile
+		// expected number of tickets and earliest first ticket
+		min, max int
+		first    time.Duration
+	}{
+		// integral of the ramp is 10 requests, the first one after 63ms
+		{profile{{0, 100, 200 * time.Millisecond}}, 9, 11, 50 * time.Millisecond},
+		// idle stage sends nothing, the last ticket may fall on profile end
+		{profile{{0, 0, 100 * time.Millisecond}, {50, 50, 200 * time.Millisecond}}, 9, 10, 100 * time.Millisecond},
+		// requests accumulated below 1 rps are carried to the next stage
+		{profile{{0, 1, 100 * time.Millisecond}, {2, 2, 600 * time.Millisecond}}, 1, 1, 500 * time.Millisecond},
+	}
+	for caseid, c := range tests {
+		start := time.Now()
+		tickets := make(chan ticket, 100)
+		schedule(context.Background(), c.p, start, tickets)
+		var got []ticket
+		for t := range tickets {
+			got = append(got, t)
+		}
+		if len(got) < c.min || len(got) > c.max {
+			t.Errorf("case #%d, ticket number incorrect: %d", caseid+1, len(got))
+			continue
+		}
+		if d := got[0].intended.Sub(start); d < c.first {
+			t.Errorf("case #%d, first ticket too early: %v", caseid+1, d)
+		}
+		end := start.Add(c.p.End(len(c.p) - 1))
+		if last := got[len(got)-1].intended; last.After(end) {
+			t.Errorf("case #%d, ticket beyond profile end: %v", caseid+1, last.Sub(end))
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package archer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/context"
+)
+
+// Record is a captured request replayed by archer
+type Record struct {
+	Method  string  `json:"method"`
+	URL     string  `json:"url"`
+	Headers Headers `json:"headers"`
+	Body    string  `json:"body"`
+	// offset from the start of capture in milliseconds
+	Offset float64 `json:"offset_ms"`
+}
+
+// Headers are request headers in order, a name may be repeated. In JSON
+// they are an object of a value or a list of values for each name, e.g.
+// {"Accept": "*/*", "Cookie": ["a=1", "b=2"]}, names are sorted.
+type Headers []Header
+
+func (h *Headers) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ret Headers
+	for _, name := range names {
+		var values []string
+		if err := json.Unmarshal(raw[name], &values); err != nil {
+			var v string
+			if err := json.Unmarshal(raw[name], &v); err != nil {
+				return errors.New("invalid value of header " + name)
+			}
+			values = []string{v}
+		}
+		for _, v := range values {
+			ret = append(ret, Header{Key: name, Value: v})
+		}
+	}
+	*h = ret
+	return nil
+}
+
+// harFile is the subset of HAR format used for replay
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// LoadRecords reads captured requests from a HAR file or a JSONL file
+// with one Record per line, records are sorted by offset. Files named
+// *.har are HAR files and *.jsonl are JSONL files, others are HAR files
+// if the first JSON object has a "log" field.
+func LoadRecords(path string) ([]Record, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if isHAR(path, raw) {
+		records, err = parseHAR(raw)
+	} else {
+		records, err = parseJSONL(raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no record found in " + path)
+	}
+	sort.Stable(byOffset(records))
+	return records, nil
+}
+
+// isHAR returns true if file at path with content raw is a HAR file
+func isHAR(path string, raw []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".har":
+		return true
+	case ".jsonl":
+		return false
+	}
+	var first map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(raw)).Decode(&first); err != nil {
+		return false
+	}
+	_, ok := first["log"]
+	return ok
+}
+
+func parseHAR(raw []byte) ([]Record, error) {
+	var har harFile
+	if err := json.Unmarshal(raw, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %v", err)
+	}
+	entries := har.Log.Entries
+	if len(entries) == 0 {
+		return nil, errors.New("no HAR entries")
+	}
+	start := entries[0].StartedDateTime
+	for _, e := range entries {
+		if e.StartedDateTime.Before(start) {
+			start = e.StartedDateTime
+		}
+	}
+	ret := make([]Record, len(entries))
+	for i, e := range entries {
+		r := Record{
+			Method: e.Request.Method,
+			URL:    e.Request.URL,
+			Body:   e.Request.PostData.Text,
+			Offset: float64(e.StartedDateTime.Sub(start)) / float64(time.Millisecond),
+		}
+		for _, h := range e.Request.Headers {
+			r.Headers = append(r.Headers, Header{Key: h.Name, Value: h.Value})
+		}
+		ret[i] = r
+	}
+	return ret, nil
+}
+
+func parseJSONL(raw []byte) ([]Record, error) {
+	var ret []Record
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(nil, len(raw)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid record at line %d: %v", line, err)
+		}
+		ret = append(ret, r)
+	}
+	return ret, scanner.Err()
+}
+
+type byOffset []Record
+
+func (r byOffset) Len() int           { return len(r) }
+func (r byOffset) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byOffset) Less(i, j int) bool { return r[i].Offset < r[j].Offset }
+
+// replayRecord is a Record prepared for sending
+type replayRecord struct {
+	Record
+	req *fasthttp.Request
+}
+
+// skipReplayHeader returns true for headers set by http client itself,
+// HTTP/2 pseudo headers captured in HAR files are skipped as well.
+func skipReplayHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "content-length", "connection", "transfer-encoding":
+		return true
+	}
+	return strings.HasPrefix(name, ":")
+}
+
+// newReplayRecord prepares request of r, headers replace the captured
+// ones with the same names.
+func newReplayRecord(r Record, headers []Header) *replayRecord {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(r.URL)
+	req.Header.SetHostBytes(req.URI().Host())
+	req.Header.SetMethod(strings.ToUpper(r.Method))
+	var captured []Header
+	for _, h := range r.Headers {
+		if !skipReplayHeader(h.Key) {
+			captured = append(captured, h)
+		}
+	}
+	setHeaders(req, captured)
+	setHeaders(req, headers)
+	// GET and HEAD requests can not carry body
+	if !req.Header.IsGet() && !req.Header.IsHead() {
+		req.SetBodyString(r.Body)
+		req.Header.SetContentLength(len(r.Body))
+	}
+	return &replayRecord{
+		Record: r,
+		req:    req,
+	}
+}
+
+// replay dispatches records to workers in order, if speed is positive
+// records are sent at their captured offsets divided by speed, otherwise
+// as fast as possible. It closes tickets after the last record and returns
+// when ctx is done.
+func replay(ctx context.Context, records []*replayRecord, speed float64, start time.Time, tickets chan<- ticket) {
+	for i, r := range records {
+		t := ticket{record: i}
+		if speed > 0 {
+			t.intended = start.Add(time.Duration(r.Offset * float64(time.Millisecond) / speed))
+			if !sleep(ctx, t.intended.Sub(time.Now())) {
+				return
+			}
+		}
+		select {
+		case tickets <- t:
+		case <-ctx.Done():
+			return
+		}
+	}
+	close(tickets)
+}
+
+// replayFailure is a failed replay record
+type replayFailure struct {
+	index int
+	err   error
+}
+
+// replayFailures collects failed replay records from all workers
+type replayFailures struct {
+	sync.Mutex
+	failures []replayFailure
+}
+
+func (f *replayFailures) Add(index int, err error) {
+	f.Lock()
+	f.failures = append(f.failures, replayFailure{index, err})
+	f.Unlock()
+}
+
+// maxPrintedFailures limits the number of failed records printed in summary
+const maxPrintedFailures = 100
+
+// Print prints failed records in record order
+func (f *replayFailures) Print(records []*replayRecord) {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.failures) == 0 {
+		return
+	}
+	sort.Sort(byIndex(f.failures))
+	log.Printf("Replay Failed Records: %v/%v", len(f.failures), len(records))
+	for i, rf := range f.failures {
+		if i >= maxPrintedFailures {
+			log.Printf("... %v more", len(f.failures)-maxPrintedFailures)
+			break
+		}
+		r := records[rf.index]
+		log.Printf("Record #%d %s %s (offset %vms): %v", rf.index+1, r.Method, r.URL, r.Offset, rf.err)
+	}
+}
+
+type byIndex []replayFailure
+
+func (f byIndex) Len() int           { return len(f) }
+func (f byIndex) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byIndex) Less(i, j int) bool { return f[i].index < f[j].index }
@@ -0,0 +1,114 @@
+package archer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadRecords(t *testing.T) {
+	var tests = []struct {
+		s   string
+		e   []Record
+		err bool
+	}{
+		{
+			`{"method": "POST", "url": "http://127.0.0.1:8080/b", "body": "b", "offset_ms": 20}
+{"method": "GET", "url": "http://127.0.0.1:8080/a", "headers": {"Accept": "*/*", "Cookie": ["a=1", "b=2"]}, "offset_ms": 10}
+
+`,
+			[]Record{
+				{Method: "GET", URL: "http://127.0.0.1:8080/a", Headers: Headers{{"Accept", "*/*"}, {"Cookie", "a=1"}, {"Cookie", "b=2"}}, Offset: 10},
+				{Method: "POST", URL: "http://127.0.0.1:8080/b", Body: "b", Offset: 20},
+			},
+			false,
+		},
+		{
+			`{"log": {"entries": [
+	{"startedDateTime": "2017-01-01T00:00:01.500Z", "request": {"method": "POST", "url": "http://127.0.0.1:8080/b",
+		"headers": [{"name": "Content-Type", "value": "text/plain"}, {"name": "Cookie", "value": "a=1"},
+			{"name": "Cookie", "value": "b=2"}], "postData": {"text": "b"}}},
+	{"startedDateTime": "2017-01-01T00:00:01.000Z", "request": {"method": "GET", "url": "http://127.0.0.1:8080/a",
+		"headers": []}}
+]}}`,
+			[]Record{
+				{Method: "GET", URL: "http://127.0.0.1:8080/a", Offset: 0},
+				{Method: "POST", URL: "http://127.0.0.1:8080/b", Headers: Headers{{"Content-Type", "text/plain"},
+					{"Cookie", "a=1"}, {"Cookie", "b=2"}}, Body: "b", Offset: 500},
+			},
+			false,
+		},
+		{
+			`{"method": "GET", "url": "http://127.0.0.1:8080/a"}
+not json`,
+			nil,
+			true,
+		},
+		{
+			`{"log": {"entries": [{"startedDateTime": "yesterday"}]}}`,
+			nil,
+			true,
+		},
+		{
+			``,
+			nil,
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		f, err := ioutil.TempFile("", "records")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		f.WriteString(c.s)
+		f.Close()
+		res, err := LoadRecords(f.Name())
+		os.Remove(f.Name())
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+		}
+		if !reflect.DeepEqual(res, c.e) {
+			t.Errorf("case #%d, result incorrect: %v", caseid+1, res)
+		}
+	}
+}
+
+func TestLoadRecordsFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	// a malformed HAR file reports HAR error instead of JSONL one
+	path := filepath.Join(dir, "traffic.har")
+	ioutil.WriteFile(path, []byte(`{"log": {"entries": [`), 0644)
+	if _, err := LoadRecords(path); err == nil || !strings.Contains(err.Error(), "HAR") {
+		t.Errorf("HAR error not returned: %v", err)
+	}
+	path = filepath.Join(dir, "traffic.jsonl")
+	ioutil.WriteFile(path, []byte(`{"method": "GET", "url": "http://127.0.0.1/", "offset_ms": 0}`), 0644)
+	if records, err := LoadRecords(path); err != nil || len(records) != 1 {
+		t.Errorf("JSONL file not loaded: %v %v", records, err)
+	}
+}
+
+func TestSkipReplayHeader(t *testing.T) {
+	for _, h := range []string{"Content-Length", "connection", ":authority"} {
+		if !skipReplayHeader(h) {
+			t.Errorf("header %s not skipped", h)
+		}
+	}
+	if skipReplayHeader("Authorization") {
+		t.Errorf("header Authorization skipped")
+	}
+}
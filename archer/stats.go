@@ -0,0 +1,102 @@
+package archer
+
+import "sync/atomic"
+
+// archerStats counts requests, sent and received payload are the sizes
+// of request and response bodies
+type archerStats struct {
+	sentPayload     uint64
+	receivedPayload uint64
+	succeeded       uint64
+	failed          uint64
+	// responses failed assertions, also counted in failed
+	assertFailed uint64
+	// requests failed without response by error class, also counted in failed
+	errors [errorClassNum]uint64
+	// response count by status code
+	status [statusNum]uint64
+}
+
+// addResponse records a received response, responses with status
+// not counted as success are failed
+func (s *archerStats) addResponse(code int, success bool, sent, received uint64) {
+	atomic.AddUint64(&s.status[statusIndex(code)], 1)
+	atomic.AddUint64(&s.sentPayload, sent)
+	atomic.AddUint64(&s.receivedPayload, received)
+	if success {
+		atomic.AddUint64(&s.succeeded, 1)
+	} else {
+		atomic.AddUint64(&s.failed, 1)
+	}
+}
+
+// addError records a request failed without response
+func (s *archerStats) addError(class errorClass) {
+	atomic.AddUint64(&s.failed, 1)
+	atomic.AddUint64(&s.errors[class], 1)
+}
+
+// addAssertFailed records a response failed assertions, the response
+// itself is recorded by addResponse as failed
+func (s *archerStats) addAssertFailed() {
+	atomic.AddUint64(&s.assertFailed, 1)
+}
+
+// Load returns a copy of s with all counters loaded atomically
+func (s *archerStats) Load() archerStats {
+	ret := archerStats{
+		sentPayload:     atomic.LoadUint64(&s.sentPayload),
+		receivedPayload: atomic.LoadUint64(&s.receivedPayload),
+		succeeded:       atomic.LoadUint64(&s.succeeded),
+		failed:          atomic.LoadUint64(&s.failed),
+		assertFailed:    atomic.LoadUint64(&s.assertFailed),
+	}
+	for i := range s.status {
+		ret.status[i] = atomic.LoadUint64(&s.status[i])
+	}
+	for i := range s.errors {
+		ret.errors[i] = atomic.LoadUint64(&s.errors[i])
+	}
+	return ret
+}
+
+// Sub returns the counters increased since o
+func (s archerStats) Sub(o archerStats) archerStats {
+	ret := archerStats{
+		sentPayload:     s.sentPayload - o.sentPayload,
+		receivedPayload: s.receivedPayload - o.receivedPayload,
+		succeeded:       s.succeeded - o.succeeded,
+		failed:          s.failed - o.failed,
+		assertFailed:    s.assertFailed - o.assertFailed,
+	}
+	for i := range s.status {
+		ret.status[i] = s.status[i] - o.status[i]
+	}
+	for i := range s.errors {
+		ret.errors[i] = s.errors[i] - o.errors[i]
+	}
+	return ret
+}
+
+// statsSnapshot is a point in time copy of archer stats
+type statsSnapshot struct {
+	archerStats
+	latency *histogram
+	// connect durations of connections opened
+	connect *histogram
+	// bytes written to and read from connections
+	sentBytes     uint64
+	receivedBytes uint64
+}
+
+// Sub returns the stats recorded between snapshot o and s
+func (s statsSnapshot) Sub(o statsSnapshot) statsSnapshot {
+	return statsSnapshot{
+		archerStats: s.archerStats.Sub(o.archerStats),
+		latency:     s.latency.Sub(o.latency),
+		connect:     s.connect.Sub(o.connect),
+		// wire bytes
+		sentBytes:     s.sentBytes - o.sentBytes,
+		receivedBytes: s.receivedBytes - o.receivedBytes,
+	}
+}
@@ -0,0 +1,88 @@
+package archer
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// statusNum is the size of status code tables, codes out of
+// [0, statusNum) are counted as 0
+const statusNum = 600
+
+// DefaultSuccessStatus is the status codes counted as success by default
+const DefaultSuccessStatus = "2xx,3xx"
+
+// statusCodes is a set of http status codes
+type statusCodes [statusNum]bool
+
+// parseStatusCodes parses comma separated status codes, each item can be
+// a code (200), a range (200-204) or a class (2xx).
+func parseStatusCodes(raw string) (*statusCodes, error) {
+	s := &statusCodes{}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		from, to := item, item
+		if len(item) == 3 && strings.HasSuffix(strings.ToLower(item), "xx") {
+			from, to = item[:1]+"00", item[:1]+"99"
+		} else if i := strings.Index(item, "-"); i >= 0 {
+			from, to = item[:i], item[i+1:]
+		}
+		f, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, errors.New("invalid status code: " + item)
+		}
+		t, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, errors.New("invalid status code: " + item)
+		}
+		if f < 100 || t >= statusNum || f > t {
+			return nil, errors.New("invalid status code: " + item)
+		}
+		for c := f; c <= t; c++ {
+			s[c] = true
+		}
+	}
+	return s, nil
+}
+
+// Contains returns true if code is in the set
+func (s *statusCodes) Contains(code int) bool {
+	if code < 0 || code >= statusNum {
+		return false
+	}
+	return s[code]
+}
+
+// statusIndex returns the index of code in status code tables
+func statusIndex(code int) int {
+	if code < 0 || code >= statusNum {
+		return 0
+	}
+	return code
+}
+
+// formatStatus formats non-zero status counters as "200: 10, 500: 2"
+func formatStatus(status *[statusNum]uint64) string {
+	var b bytes.Buffer
+	for code, c := range status {
+		if c == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		if code == 0 {
+			b.WriteString("other")
+		} else {
+			b.WriteString(strconv.Itoa(code))
+		}
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatUint(c, 10))
+	}
+	if b.Len() == 0 {
+		return "none"
+	}
+	return b.String()
+}
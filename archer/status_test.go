@@ -0,0 +1,85 @@
+package archer
+
+import "testing"
+
+func TestParseStatusCodes(t *testing.T) {
+	var tests = []struct {
+		s   string
+		in  []int
+		out []int
+		err bool
+	}{
+		{
+			"2xx,3xx",
+			[]int{200, 204, 299, 301, 399},
+			[]int{0, 199, 400, 404, 500, 599},
+			false,
+		},
+		{
+			"200, 201-204,404",
+			[]int{200, 201, 204, 404},
+			[]int{205, 400, 500},
+			false,
+		},
+		{
+			"5XX",
+			[]int{500, 503},
+			[]int{200, 600},
+			false,
+		},
+		{
+			"abc",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"204-200",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"600",
+			nil,
+			nil,
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		res, err := parseStatusCodes(c.s)
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+		}
+		for _, code := range c.in {
+			if !res.Contains(code) {
+				t.Errorf("case #%d, %d not in set", caseid+1, code)
+			}
+		}
+		for _, code := range c.out {
+			if res.Contains(code) {
+				t.Errorf("case #%d, %d in set", caseid+1, code)
+			}
+		}
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	var status [statusNum]uint64
+	if r := formatStatus(&status); r != "none" {
+		t.Errorf("result incorrect: %s", r)
+	}
+	status[0] = 1
+	status[200] = 10
+	status[503] = 2
+	if r := formatStatus(&status); r != "other: 1, 200: 10, 503: 2" {
+		t.Errorf("result incorrect: %s", r)
+	}
+}
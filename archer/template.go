@@ -0,0 +1,179 @@
+package archer
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// template is a request url, header value or body with variables
+// evaluated on each request, supported variables are:
+//
+//	{{seq}}              global request sequence, starts from 1, all {{seq}}
+//	                     variables of the same request have the same value
+//	{{randInt MIN MAX}}  random integer in [MIN, MAX]
+//	{{randString N}}     random alphanumeric string of length N
+//	{{uuid}}             random version 4 UUID
+//	{{timestamp}}        current unix time in seconds
+//	{{timestampMs}}      current unix time in milliseconds
+//	{{worker}}           id of the worker (connection) sending the request
+//
+// Templates are parsed once, executing appends to a caller owned buffer,
+// so sending templated requests does not allocate.
+type template struct {
+	segments []segment
+	// number of variables
+	vars int
+}
+
+// segment appends its value to dst
+type segment func(dst []byte, c *templateCtx) []byte
+
+// templateCtx is the per worker state used by template execution
+type templateCtx struct {
+	rnd    *rand.Rand
+	worker int
+	// global sequence and its value for current request
+	seq *uint64
+	cur uint64
+}
+
+// Next starts a new request, it must be called before executing
+// templates of the request.
+func (c *templateCtx) Next() {
+	c.cur = atomic.AddUint64(c.seq, 1)
+}
+
+const alphanumeric = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+const hexDigits = "0123456789abcdef"
+
+// parseTemplate parses raw into template, it returns error
+// for unknown variables or invalid arguments.
+func parseTemplate(raw string) (*template, error) {
+	t := &template{}
+	for len(raw) > 0 {
+		start := strings.Index(raw, "{{")
+		if start < 0 {
+			t.appendLiteral(raw)
+			break
+		}
+		end := strings.Index(raw[start:], "}}")
+		if end < 0 {
+			return nil, errors.New("unclosed template variable: " + raw[start:])
+		}
+		end += start
+		t.appendLiteral(raw[:start])
+		seg, err := parseVariable(strings.Fields(raw[start+2 : end]))
+		if err != nil {
+			return nil, err
+		}
+		t.segments = append(t.segments, seg)
+		t.vars++
+		raw = raw[end+2:]
+	}
+	return t, nil
+}
+
+func (t *template) appendLiteral(s string) {
+	if len(s) == 0 {
+		return
+	}
+	lit := []byte(s)
+	t.segments = append(t.segments, func(dst []byte, _ *templateCtx) []byte {
+		return append(dst, lit...)
+	})
+}
+
+func parseVariable(fields []string) (segment, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("empty template variable")
+	}
+	invalid := errors.New("invalid template variable: " + strings.Join(fields, " "))
+	switch fields[0] {
+	case "seq":
+		return func(dst []byte, c *templateCtx) []byte {
+			return strconv.AppendUint(dst, c.cur, 10)
+		}, nil
+	case "randInt":
+		if len(fields) != 3 {
+			return nil, invalid
+		}
+		min, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		max, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		// size of the range wraps to non-positive if it exceeds int64
+		n := max - min + 1
+		if max < min || n <= 0 {
+			return nil, invalid
+		}
+		return func(dst []byte, c *templateCtx) []byte {
+			return strconv.AppendInt(dst, min+c.rnd.Int63n(n), 10)
+		}, nil
+	case "randString":
+		if len(fields) != 2 {
+			return nil, invalid
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		return func(dst []byte, c *templateCtx) []byte {
+			for i := 0; i < n; i++ {
+				dst = append(dst, alphanumeric[c.rnd.Intn(len(alphanumeric))])
+			}
+			return dst
+		}, nil
+	case "uuid":
+		return appendUUID, nil
+	case "timestamp":
+		return func(dst []byte, _ *templateCtx) []byte {
+			return strconv.AppendInt(dst, time.Now().Unix(), 10)
+		}, nil
+	case "timestampMs":
+		return func(dst []byte, _ *templateCtx) []byte {
+			return strconv.AppendInt(dst, time.Now().UnixNano()/int64(time.Millisecond), 10)
+		}, nil
+	case "worker":
+		return func(dst []byte, c *templateCtx) []byte {
+			return strconv.AppendInt(dst, int64(c.worker), 10)
+		}, nil
+	}
+	return nil, invalid
+}
+
+// appendUUID appends a random version 4 UUID
+func appendUUID(dst []byte, c *templateCtx) []byte {
+	var b [16]byte
+	c.rnd.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	for i, v := range b {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			dst = append(dst, '-')
+		}
+		dst = append(dst, hexDigits[v>>4], hexDigits[v&0x0f])
+	}
+	return dst
+}
+
+// IsStatic returns true if t has no variables
+func (t *template) IsStatic() bool {
+	return t.vars == 0
+}
+
+// Execute appends the evaluated template to dst
+func (t *template) Execute(dst []byte, c *templateCtx) []byte {
+	for _, s := range t.segments {
+		dst = s(dst, c)
+	}
+	return dst
+}
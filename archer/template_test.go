@@ -0,0 +1,128 @@
+package archer
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	var tests = []struct {
+		s   string
+		e   string
+		err bool
+	}{
+		{
+			"/items/{{seq}}?w={{worker}}",
+			`^/items/[0-9]+\?w=7$`,
+			false,
+		},
+		{
+			`{"id": {{randInt 10 20}}, "name": "{{randString 8}}"}`,
+			`^\{"id": (1[0-9]|20), "name": "[0-9a-zA-Z]{8}"\}$`,
+			false,
+		},
+		{
+			"{{uuid}}",
+			`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+			false,
+		},
+		{
+			"{{ timestamp }}-{{timestampMs}}",
+			`^[0-9]{10}-[0-9]{13}$`,
+			false,
+		},
+		{
+			"no variables",
+			`^no variables$`,
+			false,
+		},
+		{
+			"{{unknown}}",
+			"",
+			true,
+		},
+		{
+			"{{randInt 20 10}}",
+			"",
+			true,
+		},
+		{
+			"{{randInt -9223372036854775807 -1}}",
+			`^-[0-9]+$`,
+			false,
+		},
+		{
+			"{{randInt 0 9223372036854775807}}",
+			"",
+			true,
+		},
+		{
+			"{{randInt -9223372036854775808 0}}",
+			"",
+			true,
+		},
+		{
+			"{{seq",
+			"",
+			true,
+		},
+	}
+
+	var seq uint64
+	c := &templateCtx{rnd: rand.New(rand.NewSource(1)), worker: 7, seq: &seq}
+	for caseid, tc := range tests {
+		tmpl, err := parseTemplate(tc.s)
+		if err != nil {
+			if !tc.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if tc.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			c.Next()
+			r := string(tmpl.Execute(nil, c))
+			if !regexp.MustCompile(tc.e).MatchString(r) {
+				t.Errorf("case #%d, result incorrect: %s", caseid+1, r)
+				break
+			}
+		}
+	}
+}
+
+func TestTemplateSeq(t *testing.T) {
+	var seq uint64
+	c := &templateCtx{rnd: rand.New(rand.NewSource(1)), seq: &seq}
+	tmpl, err := parseTemplate("{{seq}}-{{seq}}")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for i := 1; i <= 10; i++ {
+		c.Next()
+		if r := string(tmpl.Execute(nil, c)); r != strconv.Itoa(i)+"-"+strconv.Itoa(i) {
+			t.Errorf("sequence incorrect: %s, expecting: %d", r, i)
+		}
+	}
+}
+
+func TestTemplateAllocs(t *testing.T) {
+	var seq uint64
+	c := &templateCtx{rnd: rand.New(rand.NewSource(1)), seq: &seq}
+	tmpl, err := parseTemplate(`{"seq": {{seq}}, "id": "{{uuid}}", "n": {{randInt 1 100}}, "s": "{{randString 16}}"}`)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	buf := make([]byte, 0, 1024)
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Next()
+		buf = tmpl.Execute(buf[:0], c)
+	})
+	if allocs > 0 {
+		t.Errorf("template execution allocates: %v", allocs)
+	}
+}
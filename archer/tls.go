@@ -0,0 +1,89 @@
+package archer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// TLSConfig is the TLS settings used for https targets
+type TLSConfig struct {
+	// PEM file of CA certificates verifying server, empty means system roots
+	CAFile string
+	// PEM files of client certificate and key for mutual TLS
+	CertFile string
+	KeyFile  string
+	// skip server certificate verification
+	InsecureSkipVerify bool
+	// server name sent in SNI and verified, empty means target host
+	ServerName string
+	// minimum TLS version, 1.0, 1.1, 1.2 or 1.3, empty means Go default
+	MinVersion string
+	// comma separated cipher suite names, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, empty means Go default
+	CipherSuites string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Load builds tls.Config from c
+func (c TLSConfig) Load() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}
+	if len(c.CAFile) > 0 {
+		raw, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(raw) {
+			return nil, errors.New("no certificate found in " + c.CAFile)
+		}
+	}
+	if len(c.CertFile) > 0 || len(c.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(c.MinVersion) > 0 {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, errors.New("invalid TLS version: " + c.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+	if len(c.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range strings.Split(c.CipherSuites, ",") {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return nil, errors.New("invalid cipher suite: " + name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+	return cfg, nil
+}
+
+// handshakeError is a failed TLS handshake
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return "tls handshake: " + e.err.Error()
+}
@@ -0,0 +1,94 @@
+package archer
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalid, []byte("invalid"), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var tests = []struct {
+		c       TLSConfig
+		version uint16
+		suites  []uint16
+		err     bool
+	}{
+		{
+			TLSConfig{},
+			0,
+			nil,
+			false,
+		},
+		{
+			TLSConfig{
+				MinVersion:   "1.2",
+				CipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_RSA_WITH_AES_128_CBC_SHA",
+			},
+			tls.VersionTLS12,
+			[]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+			false,
+		},
+		{
+			TLSConfig{MinVersion: "2.0"},
+			0,
+			nil,
+			true,
+		},
+		{
+			TLSConfig{CipherSuites: "TLS_UNKNOWN"},
+			0,
+			nil,
+			true,
+		},
+		{
+			TLSConfig{CAFile: invalid},
+			0,
+			nil,
+			true,
+		},
+		{
+			TLSConfig{CertFile: invalid, KeyFile: invalid},
+			0,
+			nil,
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		cfg, err := c.c.Load()
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+			continue
+		}
+		if cfg.MinVersion != c.version {
+			t.Errorf("case #%d, version incorrect: %x", caseid+1, cfg.MinVersion)
+		}
+		if len(cfg.CipherSuites) != len(c.suites) {
+			t.Errorf("case #%d, cipher suites incorrect: %v", caseid+1, cfg.CipherSuites)
+			continue
+		}
+		for i, s := range c.suites {
+			if cfg.CipherSuites[i] != s {
+				t.Errorf("case #%d, cipher suites incorrect: %v", caseid+1, cfg.CipherSuites)
+			}
+		}
+	}
+}
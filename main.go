@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"github.com/google/subcommands"
@@ -49,6 +51,20 @@ func main() {
 type targetCmd struct {
 	bindaddr string
 	printlog bool
+	certFile string
+	keyFile  string
+	clientCA string
+	http2    bool
+	// response settings
+	response    string
+	routes      string
+	status      int
+	body        string
+	bodySize    string
+	contentType string
+	headers     util.StringList
+	delay       string
+	errorRate   float64
 	//etcd related configuartions
 	peerURLs       string
 	clientURLs     string
@@ -59,7 +75,9 @@ type targetCmd struct {
 func (*targetCmd) Name() string     { return "target" }
 func (*targetCmd) Synopsis() string { return "run as target (server) mode" }
 func (*targetCmd) Usage() string {
-	return `target [-l] [-bind] <address:port>:
+	return `target [-l] [-h2] [-bind] <address:port> [-cert] <file> [-key] <file> [-client-ca] <file>
+       [-response] <file> [-status] <code> [-body-size] <size> [-content-type] <type>
+       [-H] <header>... [-delay] <delay> [-body] <body> [-error-rate] <rate> [-routes] <file>:
   run stress in target mode, acting as http server.
 `
 }
@@ -68,6 +86,23 @@ func (t *targetCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&t.bindaddr, "bind", "0.0.0.0:8080", "target mode: local addr to bind")
 	f.BoolVar(&t.printlog, "l", false,
 		"print stat log to stdout periodically")
+	f.StringVar(&t.certFile, "cert", "", "PEM file of server certificate, target serves https if set")
+	f.StringVar(&t.keyFile, "key", "", "PEM file of server key")
+	f.StringVar(&t.clientCA, "client-ca", "",
+		"PEM file of CA certificates verifying client certificates, clients must present one if set")
+	f.BoolVar(&t.http2, "h2", false, "serve HTTP/2, h2 with -cert and -key, otherwise h2c with prior knowledge")
+	f.StringVar(&t.response, "response", "",
+		"YAML/JSON file of response settings (status, body, body_size, content_type, headers, delay, error_rate, error_status), overridden by flags")
+	f.StringVar(&t.routes, "routes", "",
+		"YAML/JSON file of route rules (method, path and response settings), requests are answered by the first matching route")
+	f.IntVar(&t.status, "status", 0, "response status code, default is 200")
+	f.StringVar(&t.body, "body", "", "response body, default is \"Stress target OK\"")
+	f.StringVar(&t.bodySize, "body-size", "", "response body size, N or MIN-MAX for random size in range")
+	f.StringVar(&t.contentType, "content-type", "", "response content type")
+	f.Var(&t.headers, "H", "extra response header \"Name: value\", can be repeated")
+	f.StringVar(&t.delay, "delay", "",
+		"delay before responding, DURATION, uniform:MIN-MAX, normal:MEAN:STDDEV or exp:MEAN")
+	f.Float64Var(&t.errorRate, "error-rate", 0, "fraction of requests answered with status 500, e.g. 0.01")
 	f.StringVar(&t.name, "name", "",
 		"etcd node name, set this value to enable etcd")
 	f.StringVar(&t.peerURLs, "peer", "",
@@ -83,10 +118,51 @@ func (t *targetCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP)
 
+	var response target.Response
+	if len(t.response) > 0 {
+		var err error
+		if response, err = target.LoadResponse(t.response); err != nil {
+			log.Fatalf("Failed to load response settings: %s", err)
+		}
+	}
+	if t.status > 0 {
+		response.Status = t.status
+	}
+	if len(t.body) > 0 {
+		response.Body = t.body
+	}
+	if t.errorRate > 0 {
+		response.ErrorRate = t.errorRate
+	}
+	if len(t.bodySize) > 0 {
+		response.BodySize = target.Size(t.bodySize)
+	}
+	if len(t.contentType) > 0 {
+		response.ContentType = t.contentType
+	}
+	if len(t.headers) > 0 {
+		response.Headers = append(response.Headers, t.headers...)
+	}
+	if len(t.delay) > 0 {
+		response.Delay = t.delay
+	}
+	var routes []target.Route
+	if len(t.routes) > 0 {
+		var err error
+		if routes, err = target.LoadRoutes(t.routes); err != nil {
+			log.Fatalf("Failed to load routes: %s", err)
+		}
+	}
 	cfg := target.Config{
-		BindAddress: t.bindaddr,
-		PrintLog:    t.printlog,
-		Sighup:      sig,
+		BindAddress:  t.bindaddr,
+		CertFile:     t.certFile,
+		KeyFile:      t.keyFile,
+		ClientCAFile: t.clientCA,
+		HTTP2:        t.http2,
+		Response:     response,
+		Routes:       routes,
+		PrintLog:     t.printlog,
+		Sighup:       sig,
 	}
 
 	// init etcd configs
@@ -115,28 +191,90 @@ func (t *targetCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 }
 
 type archerCmd struct {
-	target   string
-	interval string
-	data     string
-	printlog bool
-	printerr bool
-	verbose  bool
-	connnum  int
-	num      uint64
+	target    string
+	endpoints string
+	replay    string
+	speed     float64
+	success   string
+	asserts   util.StringList
+	samples   int
+	sampleOut string
+	method    string
+	headers   util.StringList
+	query     util.StringList
+	interval  string
+	data      string
+	printlog  bool
+	printerr  bool
+	verbose   bool
+	connnum   int
+	num       uint64
+	rate      uint64
+	profile   string
+	unit      string
+	duration  string
+	timeout   string
+	connTO    string
+	readTO    string
+	writeTO   string
+	caFile    string
+	certFile  string
+	keyFile   string
+	insecure  bool
+	sni       string
+	tlsMin    string
+	ciphers   string
+	http2     bool
+	streams   int
+	pipeline  int
+	connReqs  uint64
+	connLife  string
+	hold      int
+	holdRate  uint64
+	ping      string
+	sources   string
+	resolve   util.StringList
+	spreadDNS bool
 }
 
 func (*archerCmd) Name() string     { return "archer" }
 func (*archerCmd) Synopsis() string { return "run as archer (client) mode" }
 func (*archerCmd) Usage() string {
-	return `archer [-lev] [-c] <ConnNum> [-n] <Num> [-i] <duration> [-u] <data> 
-       -t <url>:
+	return `archer [-lev] [-h2] [-c] <ConnNum> [-streams] <num> [-pipeline] <depth> [-n] <Num> [-d] <duration> [-i] <duration> [-rate] <rps>
+       [-timeout] <duration> [-connect-timeout] <duration> [-read-timeout] <duration>
+       [-write-timeout] <duration> [-cacert] <file> [-cert] <file> [-key] <file> [-insecure]
+       [-sni] <name> [-tls-min] <version> [-ciphers] <suites>
+       [-conn-requests] <num> [-conn-lifetime] <duration>
+       [-hold] <num> [-hold-rate] <cps> [-ping] <duration> [-source] <ips>
+       [-resolve] <host:port:ip[,ip]>... [-dns-spread]
+       [-profile] <profile> [-profile-unit] <rps|conn> [-X] <method> [-H] <header>...
+       [-q] <query>... [-assert] <assertion>... [-assert-samples] <num>
+       [-assert-out] <file> [-u] <data> -t <url> | -endpoints <file>
+       | -replay <file> [-replay-speed] <speed>:
   run stress in archer mode, acting as http client.
 `
 }
 
 func (a *archerCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&a.target, "t", "", "archer mode: remote target url")
+	f.StringVar(&a.endpoints, "endpoints", "",
+		"YAML/JSON file of weighted endpoints (url, method, body, weight), overrides -t, -X and -u")
+	f.StringVar(&a.replay, "replay", "",
+		"HAR or JSONL file of captured requests (method, url, headers, body, offset_ms) to replay")
+	f.Float64Var(&a.speed, "replay-speed", 1,
+		"replay speed relative to captured timing, e.g. 2 is twice as fast, 0 means as fast as possible")
 	f.StringVar(&a.interval, "i", "100ms", "archer mode: remote target url")
+	f.StringVar(&a.method, "X", "PUT", "http request method")
+	f.StringVar(&a.success, "success", archer.DefaultSuccessStatus,
+		"comma separated status codes counted as success, e.g. 200,201-204,3xx")
+	f.Var(&a.asserts, "assert",
+		"response assertion contains:TEXT, regex:REGEXP, json:PATH=VALUE, header:NAME or size:MIN-MAX, can be repeated")
+	f.IntVar(&a.samples, "assert-samples", archer.DefaultAssertSamples,
+		"number of responses failed assertions kept as samples, 0 disables samples")
+	f.StringVar(&a.sampleOut, "assert-out", "",
+		"JSONL file to save assertion samples, empty means printing them")
+	f.Var(&a.headers, "H", "extra request header \"Name: value\", can be repeated, it replaces the default or replayed header")
+	f.Var(&a.query, "q", "extra query parameters \"key=value&key=value\", can be repeated")
 	f.StringVar(&a.data, "u", "",
 		"data to send, it will try to open file first, if failed will use the string provided.")
 	f.BoolVar(&a.printlog, "l", false,
@@ -144,12 +282,43 @@ func (a *archerCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&a.printerr, "e", false, "print client error")
 	f.BoolVar(&a.verbose, "v", false, "print log + print client error")
 	f.IntVar(&a.connnum, "c", 10, "connection number")
+	f.BoolVar(&a.http2, "h2", false, "send requests over HTTP/2, h2 for https targets and h2c for http targets")
+	f.IntVar(&a.streams, "streams", 1, "concurrent HTTP/2 streams per connection")
+	f.IntVar(&a.pipeline, "pipeline", 0, "pipelined HTTP/1.1 requests per connection, 0 means no pipelining")
+	f.Uint64Var(&a.connReqs, "conn-requests", 0,
+		"requests sent on a connection before closing it, 1 means a new connection per request, 0 means keep alive")
+	f.StringVar(&a.connLife, "conn-lifetime", "", "max lifetime of a connection, e.g. 10s, empty means no limit")
+	f.IntVar(&a.hold, "hold", 0,
+		"number of idle keep-alive connections to open and hold instead of sending requests, 0 disables it")
+	f.Uint64Var(&a.holdRate, "hold-rate", 0, "connections opened per second in hold mode, 0 means as fast as possible")
+	f.StringVar(&a.ping, "ping", "", "interval of keep-alive requests on held connections, empty means idle")
+	f.StringVar(&a.sources, "source", "", "comma separated local IP addresses connections are bound to in turn")
+	f.Var(&a.resolve, "resolve", "use addresses instead of DNS lookup for host and port, \"host:port:ip[,ip]\", can be repeated")
+	f.BoolVar(&a.spreadDNS, "dns-spread", false, "spread connections across all addresses of target host")
 	f.Uint64Var(&a.num, "n", 0, "total number of requests to send, 0 means non-stop")
+	f.StringVar(&a.duration, "d", "", "run duration, e.g. 60s, empty means non-stop")
+	f.StringVar(&a.timeout, "timeout", "", "timeout of each request, e.g. 1s, empty means no timeout")
+	f.StringVar(&a.connTO, "connect-timeout", "", "connect timeout, default is 3s")
+	f.StringVar(&a.readTO, "read-timeout", "", "timeout of each connection read, empty means no timeout")
+	f.StringVar(&a.writeTO, "write-timeout", "", "timeout of each connection write, empty means no timeout")
+	f.StringVar(&a.caFile, "cacert", "", "PEM file of CA certificates verifying https targets")
+	f.StringVar(&a.certFile, "cert", "", "PEM file of client certificate for mutual TLS")
+	f.StringVar(&a.keyFile, "key", "", "PEM file of client key for mutual TLS")
+	f.BoolVar(&a.insecure, "insecure", false, "skip server certificate verification")
+	f.StringVar(&a.sni, "sni", "", "server name sent in TLS SNI and verified, default is target host")
+	f.StringVar(&a.tlsMin, "tls-min", "", "minimum TLS version, 1.0, 1.1, 1.2 or 1.3")
+	f.StringVar(&a.ciphers, "ciphers", "", "comma separated TLS cipher suite names")
+	f.Uint64Var(&a.rate, "rate", 0,
+		"constant request rate per second independent of response time, 0 means each connection waits interval after response")
+	f.StringVar(&a.profile, "profile", "",
+		"load profile: ramp:FROM-TO:DURATION, steps:LEVEL,...:HOLD, spike:BASE-PEAK:HOLD:SPIKE or stages:FROM[-TO]:DURATION,...")
+	f.StringVar(&a.unit, "profile-unit", archer.ProfileUnitRate,
+		"unit of load profile levels, rps (requests per second) or conn (connection number, -c is replaced by the highest level)")
 }
 
-func (a *archerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (a *archerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	// check target
-	if len(a.target) == 0 {
+	if len(a.target) == 0 && len(a.endpoints) == 0 && len(a.replay) == 0 {
 		fmt.Printf("Error: you must specify target url\n")
 		f.PrintDefaults()
 		return subcommands.ExitFailure
@@ -162,6 +331,17 @@ func (a *archerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	// init signal
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP)
+	// stop workers on SIGINT/SIGTERM, a second signal terminates immediately
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-stop
+		log.Printf("Received %v, stopping archer", s)
+		signal.Stop(stop)
+		cancel()
+	}()
 	// get input data
 	var data []byte
 	file, err := os.Open(a.data)
@@ -176,17 +356,95 @@ func (a *archerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	}
 
 CONFIG:
+	var headers []archer.Header
+	for _, raw := range a.headers {
+		k, v, err := util.ParseHeader(raw)
+		if err != nil {
+			log.Fatalf("Failed to parse header: %s", err)
+		}
+		headers = append(headers, archer.Header{Key: k, Value: v})
+	}
+	query := url.Values{}
+	for _, raw := range a.query {
+		q, err := url.ParseQuery(raw)
+		if err != nil {
+			log.Fatalf("Failed to parse query: %s", err)
+		}
+		for k, vs := range q {
+			query[k] = append(query[k], vs...)
+		}
+	}
+	var endpoints []archer.Endpoint
+	if len(a.endpoints) > 0 {
+		if endpoints, err = archer.LoadEndpoints(a.endpoints); err != nil {
+			log.Fatalf("Failed to load endpoints: %s", err)
+		}
+	}
+	var records []archer.Record
+	if len(a.replay) > 0 {
+		if records, err = archer.LoadRecords(a.replay); err != nil {
+			log.Fatalf("Failed to load replay records: %s", err)
+		}
+	}
+	// 0 disables samples in flags but means default in archer config
+	samples := a.samples
+	if samples == 0 {
+		samples = -1
+	}
+	var sources []string
+	if len(a.sources) > 0 {
+		sources = strings.Split(a.sources, ",")
+	}
+	tlsConfig := archer.TLSConfig{
+		CAFile:             a.caFile,
+		CertFile:           a.certFile,
+		KeyFile:            a.keyFile,
+		InsecureSkipVerify: a.insecure,
+		ServerName:         a.sni,
+		MinVersion:         a.tlsMin,
+		CipherSuites:       a.ciphers,
+	}
 	cfg := archer.Config{
-		Target:     a.target,
-		Interval:   a.interval,
-		ConnNum:    a.connnum,
-		Data:       data,
-		PrintLog:   a.printlog,
-		PrintError: a.printerr,
-		Num:        a.num,
-		Sighup:     sig,
-	}
-	if err := archer.StartHTTPArcher(cfg); err != nil {
+		Target:           a.target,
+		Endpoints:        endpoints,
+		Replay:           records,
+		ReplaySpeed:      a.speed,
+		Method:           a.method,
+		SuccessStatus:    a.success,
+		Assertions:       a.asserts,
+		AssertSamples:    samples,
+		AssertSampleFile: a.sampleOut,
+		Headers:          headers,
+		Query:            query,
+		Interval:         a.interval,
+		Rate:             a.rate,
+		Profile:          a.profile,
+		ProfileUnit:      a.unit,
+		ConnNum:          a.connnum,
+		HTTP2:            a.http2,
+		Streams:          a.streams,
+		Pipeline:         a.pipeline,
+		ConnRequests:     a.connReqs,
+		ConnLifetime:     a.connLife,
+		Hold:             a.hold,
+		HoldRate:         a.holdRate,
+		PingInterval:     a.ping,
+		Sources:          sources,
+		Resolve:          a.resolve,
+		SpreadDNS:        a.spreadDNS,
+		Data:             data,
+		PrintLog:         a.printlog,
+		PrintError:       a.printerr,
+		Num:              a.num,
+		Duration:         a.duration,
+		RequestTimeout:   a.timeout,
+		ConnectTimeout:   a.connTO,
+		ReadTimeout:      a.readTO,
+		WriteTimeout:     a.writeTO,
+		TLS:              tlsConfig,
+		Sighup:           sig,
+	}
+	if err := archer.StartHTTPArcher(ctx, cfg); err != nil {
 		log.Fatal(err)
 	}
 	return subcommands.ExitSuccess
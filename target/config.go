@@ -14,6 +14,19 @@ var (
 type Config struct {
 	// <addr>:<port> to bind target
 	BindAddress string
+	// PEM files of server certificate and key, target serves https if set
+	CertFile string
+	KeyFile  string
+	// PEM file of CA certificates verifying client certificates,
+	// clients are required to present certificate if set
+	ClientCAFile string
+	// serve HTTP/2 instead of HTTP/1.1, h2 if TLS is enabled,
+	// otherwise h2c with prior knowledge
+	HTTP2 bool
+	// responses sent to requests not matching any route
+	Response Response
+	// route rules, requests are answered by the first matching route
+	Routes []Route
 	// if print log periodically
 	PrintLog bool
 	// signal channel for SIGHUP
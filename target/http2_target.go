@@ -0,0 +1,63 @@
+package target
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// ServeHTTP2 serves HTTP/2 on target listener, TLS connections are negotiated with ALPN
+// and plain connections use prior knowledge (h2c). Requests are handled
+// by HandleFastHTTP, so stats are the same as HTTP/1.1.
+func (h *httpTarget) ServeHTTP2() error {
+	srv := &http2.Server{}
+	opts := &http2.ServeConnOpts{Handler: http.HandlerFunc(h.HandleHTTP)}
+	for {
+		conn, err := h.ln.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.ServeConn(conn, opts)
+	}
+}
+
+// HandleHTTP converts HTTP/2 request to fasthttp and handles it with HandleFastHTTP
+func (h *httpTarget) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("failed to read request body: %v", err)
+		return
+	}
+	var req fasthttp.Request
+	req.Header.DisableNormalizing()
+	req.Header.SetMethod(r.Method)
+	req.SetRequestURI(r.RequestURI)
+	req.Header.SetHost(r.Host)
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.SetBody(body)
+	req.Header.SetContentLength(len(body))
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, remoteAddr, nil)
+	h.HandleFastHTTP(&ctx)
+
+	// connection specific headers are not allowed in HTTP/2
+	ctx.Response.Header.VisitAll(func(k, v []byte) {
+		switch http.CanonicalHeaderKey(string(k)) {
+		case "Content-Length", "Connection", "Transfer-Encoding", "Keep-Alive":
+			return
+		}
+		w.Header().Add(string(k), string(v))
+	})
+	w.WriteHeader(ctx.Response.StatusCode())
+	w.Write(ctx.Response.Body())
+}
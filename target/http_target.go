@@ -4,10 +4,14 @@ package target provides the stress server for performance testing
 package target
 
 import (
+	"bytes"
+	"crypto/tls"
 	"log"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,16 +24,50 @@ import (
 	"github.com/ksang/stress/util"
 )
 
+// statusNum is the size of status code table, codes out of
+// [0, statusNum) are counted as 0
+const statusNum = 600
+
 type httpStats struct {
-	requestCount  uint64
-	receivedBytes uint64
+	requestCount uint64
+	// body size of requests received
+	receivedPayload uint64
+	// body size of responses sent
+	sentPayload uint64
+	// response count by status code
+	status [statusNum]uint64
 }
 
 type httpTarget struct {
-	stats  httpStats
-	ln     *StatsListener
-	sighup chan os.Signal
-	etcd   *embed.Etcd
+	stats httpStats
+	ln    *StatsListener
+	// routes matched in order, responder answers requests not matching
+	// any of them
+	routes    []*route
+	responder *responder
+	sighup    chan os.Signal
+	etcd      *embed.Etcd
+}
+
+// newHTTPTarget creates target serving connections of ln
+func newHTTPTarget(cfg Config, ln *StatsListener) (*httpTarget, error) {
+	responder, err := newResponder(cfg.Response)
+	if err != nil {
+		return nil, err
+	}
+	target := &httpTarget{
+		ln:        ln,
+		responder: responder,
+		sighup:    cfg.Sighup,
+	}
+	for _, r := range cfg.Routes {
+		rt, err := newRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		target.routes = append(target.routes, rt)
+	}
+	return target, nil
 }
 
 // StatsListener records listener related stats including connection number
@@ -37,6 +75,16 @@ type httpTarget struct {
 type StatsListener struct {
 	net.Listener
 	ConnNumber uint64
+	// bytes read from and written to connections, including TLS records
+	ReceivedBytes uint64
+	SentBytes     uint64
+	// TLS handshakes completed and failed, only used if TLSConfig is set
+	HandshakeCompleted uint64
+	HandshakeFailed    uint64
+	// accepted connections are served with TLS if set
+	TLSConfig *tls.Config
+	tlsOnce   sync.Once
+	tls       *tlsListener
 }
 
 // StatsListen creats StatsListener internally creates a tcp4 net.Listener
@@ -45,11 +93,23 @@ func StatsListen(addr string) (*StatsListener, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &StatsListener{ln, 0}, nil
+	return &StatsListener{Listener: ln}, nil
 }
 
-// Accept wraps origin Accept method and records connection number
+// Accept wraps origin Accept method and records connection number, if
+// TLSConfig is set connections are returned once handshake is completed
 func (l *StatsListener) Accept() (net.Conn, error) {
+	if l.TLSConfig != nil {
+		l.tlsOnce.Do(func() {
+			l.tls = newTLSListener(l)
+		})
+		return l.tls.Accept()
+	}
+	return l.acceptRaw()
+}
+
+// acceptRaw accepts a connection recording its stats
+func (l *StatsListener) acceptRaw() (net.Conn, error) {
 	c, err := l.Listener.Accept()
 	if err != nil {
 		return nil, err
@@ -58,6 +118,15 @@ func (l *StatsListener) Accept() (net.Conn, error) {
 	return &statsListenConn{l, c}, nil
 }
 
+// Close wraps origin Close method and stops pending TLS handshakes
+func (l *StatsListener) Close() error {
+	l.tlsOnce.Do(func() {})
+	if l.tls != nil {
+		l.tls.Close()
+	}
+	return l.Listener.Close()
+}
+
 type statsListenConn struct {
 	*StatsListener
 	net.Conn
@@ -70,38 +139,126 @@ func (c *statsListenConn) Close() error {
 	return err
 }
 
+// Read wraps origin Read method and records received bytes
+func (c *statsListenConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.StatsListener.ReceivedBytes, uint64(n))
+	return n, err
+}
+
+// Write wraps origin Write method and records sent bytes
+func (c *statsListenConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.StatsListener.SentBytes, uint64(n))
+	return n, err
+}
+
 // HandleFastHTTP is request handler for http target, records stats for performance testing.
 func (h *httpTarget) HandleFastHTTP(ctx *fasthttp.RequestCtx) {
-	size := h.RequestSize(ctx)
-	atomic.AddUint64(&h.stats.receivedBytes, size)
+	atomic.AddUint64(&h.stats.receivedPayload, uint64(len(ctx.Request.Body())))
 	atomic.AddUint64(&h.stats.requestCount, 1)
-	ctx.SuccessString("Text", "Stress target OK")
+	responder := h.responder
+	for _, r := range h.routes {
+		if r.Match(ctx.Method(), ctx.Path()) {
+			atomic.AddUint64(&r.requests, 1)
+			responder = r.responder
+			break
+		}
+	}
+	responder.Respond(ctx)
+	h.recordResponse(&ctx.Response)
 }
 
-// RequestSize return the size of this http request.
-func (h *httpTarget) RequestSize(ctx *fasthttp.RequestCtx) uint64 {
-	var ret uint64
-	head := ctx.Request.Header
-	head.VisitAll(func(k, v []byte) {
-		ret += uint64(len(k))
-		ret += uint64(len(v))
-	})
-	ret += uint64(head.ContentLength())
-	return ret
+// recordResponse records stats of response sent
+func (h *httpTarget) recordResponse(res *fasthttp.Response) {
+	code := res.StatusCode()
+	if code < 0 || code >= statusNum {
+		code = 0
+	}
+	atomic.AddUint64(&h.stats.status[code], 1)
+	atomic.AddUint64(&h.stats.sentPayload, uint64(len(res.Body())))
 }
 
 func (h *httpTarget) ConnNumber() uint64 {
 	return atomic.LoadUint64(&h.ln.ConnNumber)
 }
 
+func (h *httpTarget) HandshakeCompleted() uint64 {
+	return atomic.LoadUint64(&h.ln.HandshakeCompleted)
+}
+
+func (h *httpTarget) HandshakeFailed() uint64 {
+	return atomic.LoadUint64(&h.ln.HandshakeFailed)
+}
+
+// ReceivedBytes returns bytes read from connections
 func (h *httpTarget) ReceivedBytes() uint64 {
-	return atomic.LoadUint64(&h.stats.receivedBytes)
+	return atomic.LoadUint64(&h.ln.ReceivedBytes)
+}
+
+// SentBytes returns bytes written to connections
+func (h *httpTarget) SentBytes() uint64 {
+	return atomic.LoadUint64(&h.ln.SentBytes)
+}
+
+// ReceivedPayload returns body size of requests received
+func (h *httpTarget) ReceivedPayload() uint64 {
+	return atomic.LoadUint64(&h.stats.receivedPayload)
 }
 
 func (h *httpTarget) RequestCount() uint64 {
 	return atomic.LoadUint64(&h.stats.requestCount)
 }
 
+// SentPayload returns body size of responses sent
+func (h *httpTarget) SentPayload() uint64 {
+	return atomic.LoadUint64(&h.stats.sentPayload)
+}
+
+// ResponseCount returns the number of responses sent with status code
+func (h *httpTarget) ResponseCount(code int) uint64 {
+	if code < 0 || code >= statusNum {
+		code = 0
+	}
+	return atomic.LoadUint64(&h.stats.status[code])
+}
+
+// Responses returns response count of each status code sent
+func (h *httpTarget) Responses() map[int]uint64 {
+	ret := make(map[int]uint64)
+	for code := range h.stats.status {
+		if c := atomic.LoadUint64(&h.stats.status[code]); c > 0 {
+			ret[code] = c
+		}
+	}
+	return ret
+}
+
+// formatResponses formats non-zero response counters as "200: 10, 500: 2"
+func (h *httpTarget) formatResponses() string {
+	var b bytes.Buffer
+	for code := range h.stats.status {
+		c := atomic.LoadUint64(&h.stats.status[code])
+		if c == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		if code == 0 {
+			b.WriteString("other")
+		} else {
+			b.WriteString(strconv.Itoa(code))
+		}
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatUint(c, 10))
+	}
+	if b.Len() == 0 {
+		return "none"
+	}
+	return b.String()
+}
+
 func (h *httpTarget) Close() {
 	if h.etcd != nil {
 		h.etcd.Close()
@@ -114,9 +271,12 @@ func StartHTTPTarget(cfg Config) error {
 	if err != nil {
 		log.Fatal("failed to bind: ", err)
 	}
-	target := &httpTarget{
-		ln:     sLn,
-		sighup: cfg.Sighup,
+	if sLn.TLSConfig, err = newTLSConfig(cfg); err != nil {
+		return err
+	}
+	target, err := newHTTPTarget(cfg, sLn)
+	if err != nil {
+		return err
 	}
 	server := fasthttp.Server{
 		Handler:                       target.HandleFastHTTP,
@@ -130,7 +290,15 @@ func StartHTTPTarget(cfg Config) error {
 		go target.StartEtcdServer(cfg.Etcd)
 	}
 
-	log.Printf("HTTP Target serving at: %s", cfg.BindAddress)
+	protocol := "HTTP"
+	if sLn.TLSConfig != nil {
+		protocol = "HTTPS"
+	}
+	if cfg.HTTP2 {
+		log.Printf("%s/2 Target serving at: %s", protocol, cfg.BindAddress)
+		return target.ServeHTTP2()
+	}
+	log.Printf("%s Target serving at: %s", protocol, cfg.BindAddress)
 	return server.Serve(target.ln)
 }
 
@@ -161,8 +329,16 @@ func (h *httpTarget) PrintStats(periodic bool) {
 }
 
 func (h *httpTarget) PrintStatsOnce() {
-	log.Printf("ConnNum: %v, Received Bytes: %v, Request Count: %v",
-		h.ConnNumber(), h.ReceivedBytes(), h.RequestCount())
+	log.Printf("ConnNum: %v, Received Bytes: %v, Sent Bytes: %v, Received Payload: %v, Request Count: %v",
+		h.ConnNumber(), h.ReceivedBytes(), h.SentBytes(), h.ReceivedPayload(), h.RequestCount())
+	log.Printf("Sent Payload: %v, Responses %s", h.SentPayload(), h.formatResponses())
+	for _, r := range h.routes {
+		log.Printf("Route %v Requests: %v", r, r.Requests())
+	}
+	if h.ln.TLSConfig != nil {
+		log.Printf("TLS Handshakes Completed: %v, Failed: %v",
+			h.HandshakeCompleted(), h.HandshakeFailed())
+	}
 }
 
 func (h *httpTarget) StartEtcdServer(cfg server.Config) {
@@ -210,14 +386,38 @@ func (h *httpTarget) UpdateEtcdStats() {
 
 func (h *httpTarget) UpdateEtcdStatsOnce(ctx context.Context, kv clientv3.KV) {
 	rb := strconv.FormatUint(h.ReceivedBytes(), 10)
+	sb := strconv.FormatUint(h.SentBytes(), 10)
+	rp := strconv.FormatUint(h.ReceivedPayload(), 10)
+	sp := strconv.FormatUint(h.SentPayload(), 10)
 	rc := strconv.FormatUint(h.RequestCount(), 10)
 	cn := strconv.FormatUint(h.ConnNumber(), 10)
 	name := h.etcd.Config().Name
 
 	ops := []clientv3.Op{
 		clientv3.OpPut(util.ReceivedBytesKey+"/"+name, rb),
+		clientv3.OpPut(util.SentBytesKey+"/"+name, sb),
+		clientv3.OpPut(util.ReceivedPayloadKey+"/"+name, rp),
 		clientv3.OpPut(util.RequestCountKey+"/"+name, rc),
+		clientv3.OpPut(util.SentPayloadKey+"/"+name, sp),
 		clientv3.OpPut(util.ConnNumberKey+"/"+name, cn)}
+	// one key of each route with escaped route as a single segment,
+	// e.g. stress/RouteRequestCount/GET%20%2Fitems%2F%2A/etcd0
+	for _, r := range h.routes {
+		key := util.RouteRequestCountKey + "/" + url.PathEscape(r.String()) + "/" + name
+		ops = append(ops, clientv3.OpPut(key, strconv.FormatUint(r.Requests(), 10)))
+	}
+	// one key of each status code sent, e.g. stress/ResponseCount/200/etcd0
+	for code, c := range h.Responses() {
+		key := util.ResponseCountKey + "/" + strconv.Itoa(code) + "/" + name
+		ops = append(ops, clientv3.OpPut(key, strconv.FormatUint(c, 10)))
+	}
+	if h.ln.TLSConfig != nil {
+		hc := strconv.FormatUint(h.HandshakeCompleted(), 10)
+		hf := strconv.FormatUint(h.HandshakeFailed(), 10)
+		ops = append(ops,
+			clientv3.OpPut(util.HandshakeCompletedKey+"/"+name, hc),
+			clientv3.OpPut(util.HandshakeFailedKey+"/"+name, hf))
+	}
 
 	for _, op := range ops {
 		if _, err := kv.Do(context.TODO(), op); err != nil {
@@ -1,13 +1,22 @@
 package target
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
 
 	"github.com/ksang/stress/etcd/server"
 )
@@ -17,8 +26,12 @@ func RunHTTPTarget(cfg Config) (*httpTarget, error) {
 	if err != nil {
 		return nil, err
 	}
-	target := &httpTarget{
-		ln: sLn,
+	if sLn.TLSConfig, err = newTLSConfig(cfg); err != nil {
+		return nil, err
+	}
+	target, err := newHTTPTarget(cfg, sLn)
+	if err != nil {
+		return nil, err
 	}
 	server := fasthttp.Server{
 		Handler:            target.HandleFastHTTP,
@@ -30,7 +43,11 @@ func RunHTTPTarget(cfg Config) (*httpTarget, error) {
 	if cfg.EnableEtcd {
 		go target.StartEtcdServer(cfg.Etcd)
 	}
-	go server.Serve(target.ln)
+	if cfg.HTTP2 {
+		go target.ServeHTTP2()
+	} else {
+		go server.Serve(target.ln)
+	}
 	return target, nil
 }
 
@@ -79,6 +96,224 @@ func TestConnection(t *testing.T) {
 	target.Close()
 }
 
+func TestTLS(t *testing.T) {
+	// reuse test server certificate of httptest
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	cert := ts.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg := Config{
+		BindAddress: "0.0.0.0:8890",
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+	}
+	target, err := RunHTTPTarget(cfg)
+	if err != nil {
+		t.Fatalf("failed to start target: %s", err)
+	}
+	time.Sleep(1 * time.Second)
+
+	client := http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	res, err := client.Get("https://127.0.0.1:8890")
+	if err != nil {
+		t.Fatalf("failed to connect, %s", err)
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if target.HandshakeCompleted() != 1 {
+		t.Errorf("HandshakeCompleted incorrect, not 1, actual: %v", target.HandshakeCompleted())
+	}
+
+	// plain http request fails handshake
+	if _, err := http.Get("http://127.0.0.1:8890"); err == nil {
+		t.Errorf("no error returned for plain http request")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if target.HandshakeFailed() != 1 {
+		t.Errorf("HandshakeFailed incorrect, not 1, actual: %v", target.HandshakeFailed())
+	}
+
+	// connections are seen as TLS by fasthttp
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ln, err := StatsListen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ln.TLSConfig = tlsCfg
+	defer ln.Close()
+	tlsTarget, err := newHTTPTarget(Config{}, ln)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	isTLS := make(chan bool, 1)
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		tlsTarget.HandleFastHTTP(ctx)
+		isTLS <- ctx.IsTLS()
+	})
+	res, err = client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect, %s", err)
+	}
+	res.Body.Close()
+	if !<-isTLS {
+		t.Errorf("TLS connection not seen as TLS")
+	}
+
+	cfg.ClientCAFile = filepath.Join(dir, "missing.pem")
+	if _, err := newTLSConfig(cfg); err == nil {
+		t.Errorf("no error returned for missing client CA")
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	cfg := Config{
+		BindAddress: "0.0.0.0:8891",
+		HTTP2:       true,
+	}
+	target, err := RunHTTPTarget(cfg)
+	if err != nil {
+		t.Fatalf("failed to start target: %s", err)
+	}
+	time.Sleep(1 * time.Second)
+
+	// h2c with prior knowledge
+	transport := http2.Transport{
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	client := http.Client{
+		Transport: &transport,
+	}
+	res, err := client.Post("https://127.0.0.1:8891", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("failed to connect, %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.ProtoMajor != 2 || string(body) != "Stress target OK" {
+		t.Errorf("response incorrect: %v %s", res.Proto, body)
+	}
+	if target.RequestCount() != 1 || target.ReceivedBytes() == 0 || target.ReceivedPayload() != 5 {
+		t.Errorf("stats incorrect, RequestCount: %v, ReceivedBytes: %v, ReceivedPayload: %v",
+			target.RequestCount(), target.ReceivedBytes(), target.ReceivedPayload())
+	}
+	if target.ConnNumber() != 1 {
+		t.Errorf("ConnNumber incorrect, not 1, actual: %v", target.ConnNumber())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	cfg := Config{
+		BindAddress: "0.0.0.0:8892",
+	}
+	target, err := RunHTTPTarget(cfg)
+	if err != nil {
+		t.Fatalf("failed to start target: %s", err)
+	}
+	time.Sleep(1 * time.Second)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:8892")
+	if err != nil {
+		t.Fatalf("failed to connect, %s", err)
+	}
+	// chunked request body
+	req := "POST / HTTP/1.1\r\nHost: 127.0.0.1\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n" +
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatalf("%s", err)
+	}
+	res, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if target.ReceivedBytes() != uint64(len(req)) || target.SentBytes() != uint64(len(res)) {
+		t.Errorf("wire bytes incorrect, received: %v, sent: %v, expecting %v, %v",
+			target.ReceivedBytes(), target.SentBytes(), len(req), len(res))
+	}
+	if target.ReceivedPayload() != 11 {
+		t.Errorf("ReceivedPayload incorrect, not 11, actual: %v", target.ReceivedPayload())
+	}
+	if target.SentPayload() != uint64(len("Stress target OK")) {
+		t.Errorf("SentPayload incorrect, actual: %v", target.SentPayload())
+	}
+	if target.ResponseCount(200) != 1 || len(target.Responses()) != 1 {
+		t.Errorf("Responses incorrect: %v", target.Responses())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	cfg := Config{
+		BindAddress: "0.0.0.0:8893",
+		Response:    Response{Status: 404},
+		Routes: []Route{
+			{Method: "GET", Path: "/items/*", Response: Response{Body: "item"}},
+			{Method: "POST", Path: "/items", Response: Response{Status: 201}},
+		},
+	}
+	target, err := RunHTTPTarget(cfg)
+	if err != nil {
+		t.Fatalf("failed to start target: %s", err)
+	}
+	time.Sleep(1 * time.Second)
+
+	var tests = []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/items/1", 200, "item"},
+		{"GET", "/items/2", 200, "item"},
+		{"POST", "/items", 201, "Stress target OK"},
+		{"GET", "/other", 404, "Stress target OK"},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "http://127.0.0.1:8893"+tt.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("case #%d: %s", i+1, err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("case #%d: response incorrect: %d %s", i+1, res.StatusCode, body)
+		}
+	}
+	if target.routes[0].Requests() != 2 || target.routes[1].Requests() != 1 {
+		t.Errorf("route requests incorrect: %v, %v", target.routes[0].Requests(), target.routes[1].Requests())
+	}
+	if target.ResponseCount(404) != 1 {
+		t.Errorf("ResponseCount incorrect: %v", target.Responses())
+	}
+}
+
 func TestStartEtcd(t *testing.T) {
 	etcdCfg := server.Config{
 		Name:           "stress0",
@@ -0,0 +1,238 @@
+package target
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/valyala/fasthttp"
+
+	"github.com/ksang/stress/util"
+)
+
+// defaultBody is the response body if body size is not configured
+const defaultBody = "Stress target OK"
+
+// Response configures the responses of target
+type Response struct {
+	// status code, default is 200
+	Status int `json:"status"`
+	// response body, default is "Stress target OK"
+	Body string `json:"body"`
+	// body size in bytes, N for fixed size or MIN-MAX for random size
+	// in range, Body is repeated or truncated to the size
+	BodySize Size `json:"body_size"`
+	// content type, default is "Text"
+	ContentType string `json:"content_type"`
+	// extra headers in "Name: value" format
+	Headers []string `json:"headers"`
+	// delay before responding, a fixed DURATION or a distribution of
+	// uniform:MIN-MAX, normal:MEAN:STDDEV or exp:MEAN, empty means no delay
+	Delay string `json:"delay"`
+	// fraction of requests answered with ErrorStatus, in [0, 1]
+	ErrorRate float64 `json:"error_rate"`
+	// status code of error responses, default is 500
+	ErrorStatus int `json:"error_status"`
+}
+
+// Size is a size N or a range MIN-MAX, it can be decoded from either
+// a number or a string
+type Size string
+
+func (s *Size) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '"' {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		*s = Size(n)
+		return nil
+	}
+	return json.Unmarshal(b, (*string)(s))
+}
+
+// LoadResponse reads response settings from a YAML or JSON file, e.g.
+//
+//	status: 200
+//	body_size: 1024-4096
+//	content_type: application/json
+//	headers:
+//	  - "Cache-Control: no-cache"
+//	delay: normal:20ms:5ms
+//	error_rate: 0.01
+func LoadResponse(path string) (Response, error) {
+	var ret Response
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ret, err
+	}
+	err = yaml.Unmarshal(raw, &ret)
+	return ret, err
+}
+
+// responder writes responses configured by Response
+type responder struct {
+	status      int
+	contentType string
+	headers     [][2]string
+	// body of max size, responses use a prefix of it
+	body    []byte
+	minSize int
+	// delay before responding, nil means no delay
+	delay       func() time.Duration
+	errorRate   float64
+	errorStatus int
+}
+
+func newResponder(r Response) (*responder, error) {
+	body := r.Body
+	if len(body) == 0 {
+		body = defaultBody
+	}
+	ret := &responder{
+		status:      r.Status,
+		contentType: r.ContentType,
+		body:        []byte(body),
+		minSize:     len(body),
+		errorRate:   r.ErrorRate,
+		errorStatus: r.ErrorStatus,
+	}
+	if ret.status == 0 {
+		ret.status = fasthttp.StatusOK
+	}
+	if ret.errorStatus == 0 {
+		ret.errorStatus = fasthttp.StatusInternalServerError
+	}
+	for _, s := range []int{ret.status, ret.errorStatus} {
+		if s < 100 || s >= statusNum {
+			return nil, errors.New("invalid response status: " + strconv.Itoa(s))
+		}
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return nil, errors.New("invalid error rate: " + strconv.FormatFloat(r.ErrorRate, 'g', -1, 64))
+	}
+	if len(ret.contentType) == 0 {
+		ret.contentType = "Text"
+	}
+	for _, raw := range r.Headers {
+		k, v, err := util.ParseHeader(raw)
+		if err != nil {
+			return nil, err
+		}
+		ret.headers = append(ret.headers, [2]string{k, v})
+	}
+	if len(r.BodySize) > 0 {
+		min, max, err := parseSizeRange(string(r.BodySize))
+		if err != nil {
+			return nil, err
+		}
+		ret.minSize = min
+		ret.body = make([]byte, max)
+		for i := range ret.body {
+			ret.body[i] = body[i%len(body)]
+		}
+	}
+	delay, err := parseDelay(r.Delay)
+	if err != nil {
+		return nil, err
+	}
+	ret.delay = delay
+	return ret, nil
+}
+
+// parseSizeRange parses N or MIN-MAX
+func parseSizeRange(raw string) (int, int, error) {
+	from, to := raw, raw
+	if i := strings.Index(raw, "-"); i >= 0 {
+		from, to = raw[:i], raw[i+1:]
+	}
+	min, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, errors.New("invalid body size: " + raw)
+	}
+	max, err := strconv.Atoi(to)
+	if err != nil || min < 0 || min > max {
+		return 0, 0, errors.New("invalid body size: " + raw)
+	}
+	return min, max, nil
+}
+
+// parseDelay parses a fixed delay or a delay distribution, supported
+// formats are:
+//
+//	DURATION             fixed delay, e.g. 10ms
+//	uniform:MIN-MAX      uniformly distributed in [MIN, MAX]
+//	normal:MEAN:STDDEV   normally distributed, negative values are 0
+//	exp:MEAN             exponentially distributed
+func parseDelay(raw string) (func() time.Duration, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	invalid := errors.New("invalid delay: " + raw)
+	parts := strings.Split(raw, ":")
+	if len(parts) == 1 {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return nil, invalid
+		}
+		return func() time.Duration { return d }, nil
+	}
+	args := parts[1:]
+	if parts[0] == "uniform" && len(args) == 1 {
+		// range separator, durations themselves are not negative
+		args = strings.SplitN(args[0], "-", 2)
+	}
+	ds := make([]time.Duration, len(args))
+	for i, a := range args {
+		d, err := time.ParseDuration(a)
+		if err != nil || d < 0 {
+			return nil, invalid
+		}
+		ds[i] = d
+	}
+	switch {
+	case parts[0] == "uniform" && len(ds) == 2 && ds[0] <= ds[1]:
+		min, max := ds[0], ds[1]
+		return func() time.Duration {
+			return min + time.Duration(rand.Int63n(int64(max-min)+1))
+		}, nil
+	case parts[0] == "normal" && len(ds) == 2:
+		mean, stddev := float64(ds[0]), float64(ds[1])
+		return func() time.Duration {
+			return time.Duration(math.Max(0, rand.NormFloat64()*stddev+mean))
+		}, nil
+	case parts[0] == "exp" && len(ds) == 1:
+		mean := float64(ds[0])
+		return func() time.Duration {
+			return time.Duration(rand.ExpFloat64() * mean)
+		}, nil
+	}
+	return nil, invalid
+}
+
+// Respond waits for the delay and writes the response to ctx
+func (r *responder) Respond(ctx *fasthttp.RequestCtx) {
+	if r.delay != nil {
+		time.Sleep(r.delay())
+	}
+	size := len(r.body)
+	if r.minSize < size {
+		size = r.minSize + rand.Intn(size-r.minSize+1)
+	}
+	status := r.status
+	if r.errorRate > 0 && rand.Float64() < r.errorRate {
+		status = r.errorStatus
+	}
+	ctx.SetStatusCode(status)
+	ctx.SetContentType(r.contentType)
+	for _, h := range r.headers {
+		ctx.Response.Header.Add(h[0], h[1])
+	}
+	ctx.SetBody(r.body[:size])
+}
@@ -0,0 +1,132 @@
+package target
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseDelay(t *testing.T) {
+	var tests = []struct {
+		raw      string
+		min, max time.Duration
+		err      bool
+	}{
+		{"", 0, 0, false},
+		{"10ms", 10 * time.Millisecond, 10 * time.Millisecond, false},
+		{"uniform:10ms-20ms", 10 * time.Millisecond, 20 * time.Millisecond, false},
+		{"normal:20ms:0s", 20 * time.Millisecond, 20 * time.Millisecond, false},
+		{"exp:10ms", 0, time.Hour, false},
+		{"-1s", 0, 0, true},
+		{"uniform:20ms-10ms", 0, 0, true},
+		{"uniform:10ms", 0, 0, true},
+		{"normal:20ms", 0, 0, true},
+		{"poisson:10ms", 0, 0, true},
+	}
+	for i, tt := range tests {
+		delay, err := parseDelay(tt.raw)
+		if (err != nil) != tt.err {
+			t.Errorf("case #%d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if delay == nil {
+			if !tt.err && len(tt.raw) > 0 {
+				t.Errorf("case #%d: no delay returned", i+1)
+			}
+			continue
+		}
+		for j := 0; j < 100; j++ {
+			if d := delay(); d < tt.min || d > tt.max {
+				t.Errorf("case #%d: delay %v not in [%v, %v]", i+1, d, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestResponder(t *testing.T) {
+	var tests = []struct {
+		r           Response
+		status      int
+		contentType string
+		min, max    int
+		header      string
+		err         bool
+	}{
+		{
+			r:           Response{},
+			status:      200,
+			contentType: "Text",
+			min:         len(defaultBody),
+			max:         len(defaultBody),
+		},
+		{
+			r: Response{
+				Status:      503,
+				BodySize:    "1024",
+				ContentType: "application/json",
+				Headers:     []string{"X-Stress: target"},
+			},
+			status:      503,
+			contentType: "application/json",
+			min:         1024,
+			max:         1024,
+			header:      "target",
+		},
+		{
+			r:           Response{BodySize: "0-100"},
+			status:      200,
+			contentType: "Text",
+			min:         0,
+			max:         100,
+		},
+		{
+			r:           Response{Body: "hello", BodySize: "12", ErrorRate: 1, ErrorStatus: 503},
+			status:      503,
+			contentType: "Text",
+			min:         12,
+			max:         12,
+		},
+		{
+			r:   Response{Status: 1000},
+			err: true,
+		},
+		{
+			r:   Response{ErrorRate: 2},
+			err: true,
+		},
+		{
+			r:   Response{BodySize: "100-10"},
+			err: true,
+		},
+		{
+			r:   Response{Headers: []string{"invalid"}},
+			err: true,
+		},
+	}
+	for i, tt := range tests {
+		r, err := newResponder(tt.r)
+		if (err != nil) != tt.err {
+			t.Errorf("case #%d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for j := 0; j < 10; j++ {
+			ctx := &fasthttp.RequestCtx{}
+			r.Respond(ctx)
+			res := &ctx.Response
+			if res.StatusCode() != tt.status || string(res.Header.ContentType()) != tt.contentType {
+				t.Errorf("case #%d: response incorrect: %d %s", i+1, res.StatusCode(), res.Header.ContentType())
+			}
+			if n := len(res.Body()); n < tt.min || n > tt.max {
+				t.Errorf("case #%d: body size %d not in [%d, %d]", i+1, n, tt.min, tt.max)
+			}
+			if h := string(res.Header.Peek("X-Stress")); h != tt.header {
+				t.Errorf("case #%d: header incorrect: %q", i+1, h)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package target
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ghodss/yaml"
+)
+
+// Route answers requests matching Method and Path with its Response
+type Route struct {
+	// request method, empty or "*" means any method
+	Method string `json:"method"`
+	// path pattern, a pattern ending with "*" matches paths with the
+	// prefix before it, others are matched by path.Match, e.g. /items/?
+	Path string `json:"path"`
+	Response
+}
+
+// LoadRoutes reads route rules from a YAML or JSON file, requests are
+// answered by the first matching route, e.g.
+//
+//   - method: GET
+//     path: /items/*
+//     body_size: 1024-4096
+//     delay: normal:20ms:5ms
+//   - method: POST
+//     path: /items
+//     status: 201
+//     error_rate: 0.01
+func LoadRoutes(path string) ([]Route, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Route
+	if err := yaml.Unmarshal(raw, &ret); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no route found in " + path)
+	}
+	return ret, nil
+}
+
+// route is a Route prepared for matching with its own request counter
+type route struct {
+	method  string
+	pattern string
+	// pattern is a prefix
+	prefix    bool
+	responder *responder
+	requests  uint64
+}
+
+func newRoute(r Route) (*route, error) {
+	if len(r.Path) == 0 || r.Path[0] != '/' {
+		return nil, errors.New("invalid route path: " + r.Path)
+	}
+	ret := &route{
+		method:  strings.ToUpper(r.Method),
+		pattern: r.Path,
+	}
+	if ret.method == "*" {
+		ret.method = ""
+	}
+	if strings.HasSuffix(r.Path, "*") {
+		ret.prefix = true
+		ret.pattern = strings.TrimSuffix(r.Path, "*")
+	} else if _, err := path.Match(r.Path, "/"); err != nil {
+		return nil, errors.New("invalid route path: " + r.Path)
+	}
+	responder, err := newResponder(r.Response)
+	if err != nil {
+		return nil, err
+	}
+	ret.responder = responder
+	return ret, nil
+}
+
+// Match returns true if request of method to path matches the route
+func (r *route) Match(method, p []byte) bool {
+	if len(r.method) > 0 && string(method) != r.method {
+		return false
+	}
+	if r.prefix {
+		return strings.HasPrefix(string(p), r.pattern)
+	}
+	ok, _ := path.Match(r.pattern, string(p))
+	return ok
+}
+
+// Requests returns the number of requests matched the route
+func (r *route) Requests() uint64 {
+	return atomic.LoadUint64(&r.requests)
+}
+
+// String returns method and path of the route, e.g. "GET /items/*"
+func (r *route) String() string {
+	method := r.method
+	if len(method) == 0 {
+		method = "*"
+	}
+	if r.prefix {
+		return method + " " + r.pattern + "*"
+	}
+	return method + " " + r.pattern
+}
@@ -0,0 +1,73 @@
+package target
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	var tests = []struct {
+		r      Route
+		method string
+		path   string
+		match  bool
+		err    bool
+	}{
+		{Route{Method: "GET", Path: "/items"}, "GET", "/items", true, false},
+		{Route{Method: "get", Path: "/items"}, "POST", "/items", false, false},
+		{Route{Path: "/items"}, "POST", "/items", true, false},
+		{Route{Method: "*", Path: "/items/*"}, "PUT", "/items/1/detail", true, false},
+		{Route{Path: "/items/*"}, "GET", "/items", false, false},
+		{Route{Path: "/items/?/detail"}, "GET", "/items/1/detail", true, false},
+		{Route{Path: "/items/?/detail"}, "GET", "/items/10/detail", false, false},
+		{Route{Path: "items"}, "", "", false, true},
+		{Route{Path: "/items/[", Method: "GET"}, "", "", false, true},
+		{Route{Path: "/items", Response: Response{Status: 1}}, "", "", false, true},
+	}
+	for i, tt := range tests {
+		r, err := newRoute(tt.r)
+		if (err != nil) != tt.err {
+			t.Errorf("case #%d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if m := r.Match([]byte(tt.method), []byte(tt.path)); m != tt.match {
+			t.Errorf("case #%d: %v match %s %s: %v", i+1, r, tt.method, tt.path, m)
+		}
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routes.yaml")
+	raw := `
+- method: GET
+  path: /items/*
+  body_size: 1024
+  headers:
+    - "Cache-Control: no-cache"
+- method: POST
+  path: /items
+  status: 201
+  error_rate: 0.5
+`
+	if err := ioutil.WriteFile(file, []byte(raw), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	routes, err := LoadRoutes(file)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(routes) != 2 || routes[0].Path != "/items/*" || routes[0].BodySize != "1024" ||
+		len(routes[0].Headers) != 1 || routes[1].Status != 201 || routes[1].ErrorRate != 0.5 {
+		t.Errorf("routes incorrect: %+v", routes)
+	}
+}
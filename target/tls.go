@@ -0,0 +1,117 @@
+package target
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// newTLSConfig loads server certificate and client CA of cfg,
+// it returns nil if TLS is not enabled
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if len(cfg.CertFile) == 0 && len(cfg.KeyFile) == 0 {
+		if len(cfg.ClientCAFile) > 0 {
+			return nil, errors.New("client CA requires server certificate and key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ret := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if len(cfg.ClientCAFile) > 0 {
+		raw, err := ioutil.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		ret.ClientCAs = x509.NewCertPool()
+		if !ret.ClientCAs.AppendCertsFromPEM(raw) {
+			return nil, errors.New("no certificate found in " + cfg.ClientCAFile)
+		}
+		ret.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if cfg.HTTP2 {
+		ret.NextProtos = []string{http2.NextProtoTLS}
+	}
+	return ret, nil
+}
+
+// handshakeTimeout limits TLS handshake of accepted connections
+const handshakeTimeout = 10 * time.Second
+
+// tlsListener completes TLS handshakes of accepted connections in
+// background and records the results, Accept returns *tls.Conn so that
+// servers see connections as TLS.
+type tlsListener struct {
+	ln    *StatsListener
+	conns chan net.Conn
+	// error of underlying Accept, set before conns is closed
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newTLSListener(ln *StatsListener) *tlsListener {
+	l := &tlsListener{
+		ln:    ln,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	go l.serve()
+	return l
+}
+
+func (l *tlsListener) serve() {
+	defer close(l.conns)
+	for {
+		c, err := l.ln.acceptRaw()
+		if err != nil {
+			l.err = err
+			return
+		}
+		go l.handshake(tls.Server(c, l.ln.TLSConfig))
+	}
+}
+
+// handshake completes handshake of c and hands it to Accept
+func (l *tlsListener) handshake(c *tls.Conn) {
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		atomic.AddUint64(&l.ln.HandshakeFailed, 1)
+		c.Close()
+		return
+	}
+	atomic.AddUint64(&l.ln.HandshakeCompleted, 1)
+	c.SetDeadline(time.Time{})
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+// Accept returns the next connection with handshake completed
+func (l *tlsListener) Accept() (net.Conn, error) {
+	c, ok := <-l.conns
+	if !ok {
+		return nil, l.err
+	}
+	return c, nil
+}
+
+// Close closes connections waiting for Accept afterwards
+func (l *tlsListener) Close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+}
@@ -4,14 +4,22 @@ package util provides utilities used by stress
 package util
 
 import (
+	"errors"
 	"net/url"
 	"strings"
 )
 
 const (
-	ConnNumberKey    = "stress/ConnectionNumber"
-	ReceivedBytesKey = "stress/ReceivedBytes"
-	RequestCountKey  = "stress/RequestCount"
+	ConnNumberKey         = "stress/ConnectionNumber"
+	ReceivedBytesKey      = "stress/ReceivedBytes"
+	SentBytesKey          = "stress/SentBytes"
+	ReceivedPayloadKey    = "stress/ReceivedPayload"
+	SentPayloadKey        = "stress/SentPayload"
+	ResponseCountKey      = "stress/ResponseCount"
+	RouteRequestCountKey  = "stress/RouteRequestCount"
+	RequestCountKey       = "stress/RequestCount"
+	HandshakeCompletedKey = "stress/HandshakeCompleted"
+	HandshakeFailedKey    = "stress/HandshakeFailed"
 )
 
 // ParseStringToUrl parse comma saperated url string to []url.URL
@@ -41,6 +49,31 @@ func ParseUrlsToStrings(urls []url.URL) []string {
 	return ret
 }
 
+// ParseHeader parse curl style "Name: value" header string
+func ParseHeader(raw string) (string, string, error) {
+	i := strings.Index(raw, ":")
+	if i <= 0 {
+		return "", "", errors.New("invalid header: " + raw)
+	}
+	key := strings.TrimSpace(raw[:i])
+	if len(key) == 0 {
+		return "", "", errors.New("invalid header: " + raw)
+	}
+	return key, strings.TrimSpace(raw[i+1:]), nil
+}
+
+// StringList is a flag.Value collecting values of a repeatable flag
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 // to ensure localhost is translated to 127.0.0.1
 func convertLocalhost(raw string) string {
 	return strings.Replace(raw, "localhost", "127.0.0.1", 1)
@@ -76,3 +76,59 @@ func TestUrlsToStrings(t *testing.T) {
 		t.Logf("Result: %v", t)
 	}
 }
+
+func TestParseHeader(t *testing.T) {
+	var tests = []struct {
+		s   string
+		k   string
+		v   string
+		err bool
+	}{
+		{
+			"Content-Type: application/json",
+			"Content-Type",
+			"application/json",
+			false,
+		},
+		{
+			"Authorization:Bearer a:b",
+			"Authorization",
+			"Bearer a:b",
+			false,
+		},
+		{
+			"X-Empty:",
+			"X-Empty",
+			"",
+			false,
+		},
+		{
+			"no separator",
+			"",
+			"",
+			true,
+		},
+		{
+			": value",
+			"",
+			"",
+			true,
+		},
+	}
+
+	for caseid, c := range tests {
+		k, v, err := ParseHeader(c.s)
+		if err != nil {
+			if !c.err {
+				t.Errorf("case #%d, err: %v", caseid+1, err)
+			}
+			continue
+		}
+		if c.err {
+			t.Errorf("case #%d, no error returned, expecting error", caseid+1)
+		}
+		if k != c.k || v != c.v {
+			t.Errorf("case #%d, result incorrect: %q %q", caseid+1, k, v)
+		}
+	}
+}